@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// adaptiveWindow is how many recent latencies WithAdaptiveTimeout keeps.
+	adaptiveWindow = 128
+
+	// adaptiveWarmup is how many latencies WithAdaptiveTimeout needs before
+	// it stops using its maximum.
+	adaptiveWarmup = 10
+)
+
+// adaptiveTimeout derives per-item timeouts from a sliding window of recent
+// completion latencies. The current timeout is recomputed on every sample
+// and published atomically, so reading it costs one atomic load.
+type adaptiveTimeout struct {
+	percentile float64
+	min, max   time.Duration
+
+	mu      sync.Mutex
+	samples [adaptiveWindow]time.Duration
+	n       int // samples recorded, capped at adaptiveWindow
+	next    int // index the next sample is written to
+
+	current int64 // time.Duration
+}
+
+// WithAdaptiveTimeout gives every item a timeout equal to the percentile
+// (between 0 and 100) of the latencies of the last 128 items that
+// completed, clamped to [lo, hi]. Until 10 items have completed the
+// timeout is hi. Only items that ran their work to the end are sampled, so
+// cancelled, skipped, rejected and panicked items are left out. It replaces
+// WithItemTimeout; reuse the same Option value for every call that should
+// learn from the same latencies. A percentile outside [0, 100], or a lo
+// that is negative or above hi, is invalid.
+func WithAdaptiveTimeout(percentile float64, lo, hi time.Duration) Option {
+	a := &adaptiveTimeout{
+		percentile: percentile,
+		min:        lo,
+		max:        hi,
+		current:    int64(hi),
+	}
+	return func(o *options) {
+		switch {
+		case percentile < 0 || percentile > 100:
+			o.reject("WithAdaptiveTimeout", percentile, "percentile outside [0, 100]")
+			return
+		case lo < 0 || lo > hi:
+			o.reject("WithAdaptiveTimeout", [2]time.Duration{lo, hi}, "bounds out of order")
+			return
+		}
+		o.adaptive = a
+	}
+}
+
+// timeout returns the per-item timeout to apply now.
+func (a *adaptiveTimeout) timeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&a.current))
+}
+
+// observe adds the latency d of a completed item r to the window and
+// recomputes the timeout. Items that did no work, or did not finish it, are
+// ignored: their near-zero or truncated latencies would drag the timeout
+// down. It is a no-op on a nil adaptiveTimeout.
+func (a *adaptiveTimeout) observe(r Result, d time.Duration) {
+	if a == nil {
+		return
+	}
+	switch r.Kind {
+	case KindCancelled, KindSkipped, KindRejected, KindFiltered, KindPanic:
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.samples[a.next] = d
+	a.next = (a.next + 1) % adaptiveWindow
+	if a.n < adaptiveWindow {
+		a.n++
+	}
+	if a.n < adaptiveWarmup {
+		return
+	}
+
+	sorted := make([]time.Duration, a.n)
+	copy(sorted, a.samples[:a.n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(a.percentile / 100 * float64(a.n-1))
+	t := min(max(sorted[i], a.min), a.max)
+	atomic.StoreInt64(&a.current, int64(t))
+}
+
+// itemDeadline returns the per-item timeout, zero for none.
+func (o *options) itemDeadline() time.Duration {
+	if o.adaptive != nil {
+		return o.adaptive.timeout()
+	}
+	return o.itemTimeout
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveTimeoutLearnsPercentile(t *testing.T) {
+	a := &adaptiveTimeout{percentile: 50, min: time.Millisecond, max: time.Second, current: int64(time.Second)}
+	for i := 1; i < adaptiveWarmup; i++ {
+		a.observe(Result{Kind: KindInt}, 100*time.Millisecond)
+	}
+	if got := a.timeout(); got != time.Second {
+		t.Fatalf("timeout during warmup = %v, want hi", got)
+	}
+	a.observe(Result{Kind: KindInt}, 100*time.Millisecond)
+	if got := a.timeout(); got != 100*time.Millisecond {
+		t.Fatalf("timeout after warmup = %v, want 100ms", got)
+	}
+}
+
+func TestAdaptiveTimeoutClamps(t *testing.T) {
+	a := &adaptiveTimeout{percentile: 90, min: 50 * time.Millisecond, max: 80 * time.Millisecond, current: int64(80 * time.Millisecond)}
+	for i := 0; i < adaptiveWarmup; i++ {
+		a.observe(Result{Kind: KindString}, time.Millisecond)
+	}
+	if got := a.timeout(); got != 50*time.Millisecond {
+		t.Errorf("timeout = %v, want lo", got)
+	}
+	for i := 0; i < adaptiveWindow; i++ {
+		a.observe(Result{Kind: KindString}, time.Second)
+	}
+	if got := a.timeout(); got != 80*time.Millisecond {
+		t.Errorf("timeout = %v, want hi", got)
+	}
+}
+
+func TestAdaptiveTimeoutIgnoresItemsWithoutWork(t *testing.T) {
+	a := &adaptiveTimeout{percentile: 10, min: time.Millisecond, max: time.Second, current: int64(time.Second)}
+	for i := 0; i < adaptiveWarmup; i++ {
+		a.observe(Result{Kind: KindInt}, 200*time.Millisecond)
+	}
+	for _, k := range []Kind{KindCancelled, KindSkipped, KindRejected, KindFiltered, KindPanic} {
+		for i := 0; i < adaptiveWindow; i++ {
+			a.observe(Result{Kind: k}, 0)
+		}
+	}
+	if got := a.timeout(); got != 200*time.Millisecond {
+		t.Errorf("timeout = %v, want 200ms", got)
+	}
+}
+
+func TestAdaptiveTimeoutInvalid(t *testing.T) {
+	for _, opt := range []Option{
+		WithAdaptiveTimeout(101, 0, time.Second),
+		WithAdaptiveTimeout(-1, 0, time.Second),
+		WithAdaptiveTimeout(50, time.Second, time.Millisecond),
+	} {
+		if Validate(opt) == nil {
+			t.Error("invalid WithAdaptiveTimeout accepted")
+		}
+	}
+}
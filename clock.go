@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Clock abstracts the passage of time so tests can drive processData's
+// select branches and latency measurements deterministically instead of
+// sleeping.
+type Clock interface {
+	After(d time.Duration) <-chan time.Time
+	Now() time.Time
+}
+
+// realClock is the default Clock, backed by the time package.
+type realClock struct{}
+
+// After calls time.After.
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Now calls time.Now. Its reading carries the monotonic clock, so
+// differences between two readings are immune to wall-clock changes.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock makes processData and Run wait on c instead of the wall clock.
+// A nil c keeps the real clock.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// clk returns the configured Clock, falling back to the real one.
+func (o *options) clk() Clock {
+	if o.clock == nil {
+		return realClock{}
+	}
+	return o.clock
+}
+
+// withTimeout is context.WithTimeout driven by c. With the real clock it
+// defers to the standard library; with any other Clock the returned context
+// is cancelled, with context.DeadlineExceeded as its cause, once c.After(d)
+// fires.
+func withTimeout(parent context.Context, d time.Duration, c Clock) (context.Context, context.CancelFunc) {
+	if _, ok := c.(realClock); ok {
+		return context.WithTimeout(parent, d)
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	go func() {
+		select {
+		case <-c.After(d):
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// withDeadline is context.WithDeadline driven by c. With the real clock it
+// defers to the standard library; with any other Clock the returned context
+// reports d as its Deadline and is cancelled, with context.DeadlineExceeded
+// as its cause, once c reaches d.
+func withDeadline(parent context.Context, d time.Time, c Clock) (context.Context, context.CancelFunc) {
+	if _, ok := c.(realClock); ok {
+		return context.WithDeadline(parent, d)
+	}
+	ctx, cancel := withTimeout(parent, d.Sub(c.Now()), c)
+	return deadlineContext{Context: ctx, deadline: d}, cancel
+}
+
+// deadlineContext is a context reporting a deadline kept on a fake Clock.
+type deadlineContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c deadlineContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+// afterFunc is time.AfterFunc driven by c: it calls f in its own goroutine
+// once c.After(d) fires, unless the returned stop is called first. stop does
+// not wait for an f already running and must be called at most once.
+func afterFunc(c Clock, d time.Duration, f func()) (stop func()) {
+	if _, ok := c.(realClock); ok {
+		t := time.AfterFunc(d, f)
+		return func() { t.Stop() }
+	}
+
+	// Fake clocks only offer After, so wait for it alongside done.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-c.After(d):
+			f()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// sleepCtx waits for d, returning ctx.Err() early if ctx is done first. The
+// timer is always stopped on the way out, so an early return never leaves it
+// running.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return preferWork(ctx, t.C)
+	case <-t.C:
+		return nil
+	}
+}
+
+// preferWork settles a tie between ctx and the end of the work: select picks
+// at random among ready cases, so when ctx is done it looks once more,
+// without blocking, at whether the work finished too, and reports completion
+// if so. Work that finished exactly at the deadline is never lost.
+func preferWork(ctx context.Context, done <-chan time.Time) error {
+	select {
+	case <-done:
+		return nil
+	default:
+		return ctx.Err()
+	}
+}
+
+// sleep is sleepCtx on the configured Clock. Fake clocks only offer After,
+// so their timers cannot be stopped and are left to the clock to release.
+// A d of zero or less only checks ctx.
+func (o *options) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	if _, ok := o.clk().(realClock); ok {
+		return sleepCtx(ctx, d)
+	}
+
+	after := o.clk().After(d)
+	select {
+	case <-ctx.Done():
+		return preferWork(ctx, after)
+	case <-after:
+		return nil
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock that only moves when Advance is called.
+type manualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []manualWaiter
+}
+
+type manualWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Unix(1_000_000, 0)}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, manualWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d and fires every timer now due.
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			kept = append(kept, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = kept
+}
+
+// Waiters reports how many timers are pending.
+func (c *manualClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+func TestAfterFuncFakeClock(t *testing.T) {
+	c := newManualClock()
+	fired := make(chan struct{})
+	afterFunc(c, time.Second, func() { close(fired) })
+	waitFor(t, func() bool { return c.Waiters() == 1 })
+
+	c.Advance(time.Second)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("afterFunc did not fire after the clock advanced")
+	}
+}
+
+func TestAfterFuncStop(t *testing.T) {
+	for _, c := range []Clock{realClock{}, newManualClock()} {
+		stop := afterFunc(c, time.Millisecond, func() { t.Errorf("%T: f ran after stop", c) })
+		stop()
+		if m, ok := c.(*manualClock); ok {
+			m.Advance(time.Second)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestSubmitWithTimeoutUsesPoolClock(t *testing.T) {
+	c := newManualClock()
+	p, err := NewWorkerPool(1, WithClock(c), WithNoDelay(), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	defer p.Shutdown(false)
+	if err := p.Submit(0); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	// The pool is not started, so the queue stays full until the fake
+	// timeout fires.
+	errc := make(chan error, 1)
+	go func() { errc <- p.SubmitWithTimeout(1, time.Hour) }()
+	waitFor(t, func() bool { return c.Waiters() == 1 })
+
+	c.Advance(time.Hour)
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrSubmitTimeout) {
+			t.Fatalf("SubmitWithTimeout = %v, want ErrSubmitTimeout", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SubmitWithTimeout did not time out on the pool's clock")
+	}
+}
+
+func TestRetryDeadlineUsesClock(t *testing.T) {
+	c := newManualClock()
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Hour))
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	// By the fake clock the deadline is a millisecond away, too soon for
+	// the backoff, so retry must give up without waiting.
+	c.Advance(deadline.Sub(c.Now()) - time.Millisecond)
+	o := newOptions([]Option{WithClock(c), WithRetry(3, time.Second)})
+
+	calls := 0
+	_, attempts, err := o.retry(ctx, func(context.Context) (string, error) {
+		calls++
+		return "", Retryable(errors.New("flaky"))
+	})
+	if !errors.Is(err, ErrRetryable) || attempts != 1 || calls != 1 {
+		t.Fatalf("retry = (%d attempts, %v), want 1 attempt failing with ErrRetryable", attempts, err)
+	}
+}
+
+func TestFakeClockCompletesWork(t *testing.T) {
+	c := newManualClock()
+	done := make(chan Result, 1)
+	go func() {
+		done <- Classify(context.Background(), 42, WithClock(c), WithWorkDuration(time.Second), WithLogger(nopLogger{}))
+	}()
+	waitFor(t, func() bool { return c.Waiters() == 1 })
+
+	c.Advance(time.Second)
+	select {
+	case r := <-done:
+		if r.Kind != KindInt || r.ProcessTime != time.Second {
+			t.Fatalf("Result = %s after %v, want the int branch after 1s", r.Kind, r.ProcessTime)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("work did not complete once the fake clock advanced")
+	}
+}
+
+func TestFakeClockTimesOut(t *testing.T) {
+	c := newManualClock()
+	done := make(chan []Result, 1)
+	go func() {
+		results, _ := Run(WithClock(c), WithTimeout(100*time.Millisecond), WithWorkDuration(time.Second),
+			WithItems(42), WithLogger(nopLogger{}))
+		done <- results
+	}()
+	// One timer for the batch deadline, one for the item's work.
+	waitFor(t, func() bool { return c.Waiters() == 2 })
+
+	c.Advance(100 * time.Millisecond)
+	select {
+	case results := <-done:
+		if len(results) != 1 || results[0].Kind != KindCancelled || !errors.Is(results[0].CancelCause, context.DeadlineExceeded) {
+			t.Fatalf("results = %v, want one item cut short by the deadline", results)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not time out on the fake clock")
+	}
+}
+
+func TestCancelMessagesFakeClock(t *testing.T) {
+	c := newManualClock()
+	done := make(chan Result, 1)
+	go func() {
+		done <- Classify(context.Background(), 42, WithClock(c), WithItemTimeout(100*time.Millisecond),
+			WithWorkDuration(time.Second), WithLogger(nopLogger{}))
+	}()
+	waitFor(t, func() bool { return c.Waiters() == 2 })
+	c.Advance(100 * time.Millisecond)
+	if r := <-done; r.Output != "Context timed out for data: 42 after 100ms" {
+		t.Fatalf("Output = %q, want the timeout message", r.Output)
+	}
+
+	c = newManualClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- Classify(ctx, 42, WithClock(c), WithWorkDuration(time.Second), WithLogger(nopLogger{}))
+	}()
+	waitFor(t, func() bool { return c.Waiters() == 1 })
+	c.Advance(250 * time.Millisecond)
+	cancel()
+	if r := <-done; r.Output != "Context cancelled for data: 42 after 250ms" {
+		t.Fatalf("Output = %q, want the cancellation message", r.Output)
+	}
+}
+
+func TestSleepCtxCancelledMidSleep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := sleepCtx(ctx, time.Hour)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("sleepCtx = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sleepCtx returned after %v, want soon after the cancel", elapsed)
+	}
+}
+
+func TestSleepCtxCompletes(t *testing.T) {
+	if err := sleepCtx(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("sleepCtx = %v, want nil", err)
+	}
+}
+
+// tieClock is a manualClock whose timers, once ctx is set, fire together
+// with the next one started: starting it advances the clock by its
+// duration, waits for ctx, which one of the pending timers cancels, to be
+// done, and returns a timer that has already fired. An item's work and its
+// cancellation are then both ready by the time it selects on them.
+type tieClock struct {
+	manualClock
+	ctx context.Context
+}
+
+func (c *tieClock) After(d time.Duration) <-chan time.Time {
+	if c.ctx == nil {
+		return c.manualClock.After(d)
+	}
+	c.Advance(d)
+	<-c.ctx.Done()
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+func TestPreferWork(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan time.Time, 1)
+	if err := preferWork(ctx, done); !errors.Is(err, context.Canceled) {
+		t.Errorf("preferWork with the work unfinished = %v, want context.Canceled", err)
+	}
+	done <- time.Now()
+	if err := preferWork(ctx, done); err != nil {
+		t.Errorf("preferWork with the work finished = %v, want nil", err)
+	}
+}
+
+func TestWorkAndDeadlineTiePrefersWork(t *testing.T) {
+	// select picks a ready case at random, so repeat the tie enough times
+	// for both orders to come up.
+	for i := 0; i < 50; i++ {
+		c := &tieClock{manualClock: manualClock{now: time.Unix(1_000_000, 0)}}
+		ctx, cancel := withTimeout(context.Background(), time.Second, c)
+		waitFor(t, func() bool { return c.Waiters() == 1 })
+		c.ctx = ctx
+
+		r := Classify(ctx, 42, WithClock(c), WithWorkDuration(time.Second), WithLogger(nopLogger{}))
+		cancel()
+		if r.Kind != KindInt || r.Err != nil {
+			t.Fatalf("tie %d: Result = (%s, %v), want the completed int", i, r.Kind, r.Err)
+		}
+	}
+}
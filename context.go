@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// ctxKey is the type of the context keys defined by this package, so they
+// can never collide with keys defined elsewhere.
+type ctxKey int
+
+const (
+	correlationKey ctxKey = iota
+	processOptionsKey
+	itemIndexKey
+	itemIDKey
+	workerIDKey
+	requeueKey
+)
+
+// WithCorrelationID returns a copy of ctx carrying id. processData prefixes
+// every log line with it and records it on the Result.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID stored in ctx by
+// WithCorrelationID, if any.
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(correlationKey).(string)
+	return id, ok
+}
+
+// ItemIDFromContext returns the ID Run and Dispatch gave the item processed
+// under ctx, if any.
+func ItemIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(itemIDKey).(string)
+	return id, ok
+}
+
+// WorkerIDFromContext returns the slot, from 0 to the pool size minus one,
+// of the WorkerPool worker processing the item processed under ctx, if any.
+func WorkerIDFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(workerIDKey).(int)
+	return id, ok
+}
+
+// ProcessOptions are per-item settings carried by the context, overriding
+// the options processData was called with for that item only. Fields left at
+// their zero value keep the setting from the options.
+type ProcessOptions struct {
+	Verbose      bool          // log a detail line for the item, as WithVerbose does
+	WorkDuration time.Duration // simulated work duration, as WithWorkDuration sets
+}
+
+// WithProcessOptions returns a copy of ctx carrying po for processData.
+func WithProcessOptions(ctx context.Context, po ProcessOptions) context.Context {
+	return context.WithValue(ctx, processOptionsKey, po)
+}
+
+// ProcessOptionsFromContext returns the ProcessOptions stored in ctx by
+// WithProcessOptions, if any.
+func ProcessOptionsFromContext(ctx context.Context) (ProcessOptions, bool) {
+	po, ok := ctx.Value(processOptionsKey).(ProcessOptions)
+	return po, ok
+}
+
+// WithContextValues makes processData see every key/value pair of kv in the
+// context of each item, on top of the context it was called with, so
+// hooks such as a Tracer can read them. The values are added before the
+// per-item deadline and span are derived, so they survive both. As with
+// context.WithValue, keys should be of an unexported type to avoid
+// collisions. kv is copied.
+func WithContextValues(kv map[interface{}]interface{}) Option {
+	values := make(map[interface{}]interface{}, len(kv))
+	for k, v := range kv {
+		values[k] = v
+	}
+	return func(o *options) {
+		o.ctxValues = values
+	}
+}
+
+// withValues returns ctx carrying the WithContextValues pairs.
+func (o *options) withValues(ctx context.Context) context.Context {
+	for k, v := range o.ctxValues {
+		ctx = context.WithValue(ctx, k, v)
+	}
+	return ctx
+}
+
+// MergeContexts returns a context done as soon as either a or b is done,
+// with the cause of whichever finished first as its context.Cause. Its
+// deadline is the earlier of theirs and its values are a's. The returned
+// cancel function cancels the merged context and unregisters it from b; it
+// must be called once the context is no longer needed, even if neither
+// parent is ever cancelled. No goroutine watches the parents.
+func MergeContexts(a, b context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(a)
+	stop := context.AfterFunc(b, func() { cancel(context.Cause(b)) })
+
+	stopDeadline := func() {}
+	if db, ok := b.Deadline(); ok {
+		if da, ok := a.Deadline(); !ok || db.Before(da) {
+			ctx, stopDeadline = context.WithDeadline(ctx, db)
+		}
+	}
+
+	return ctx, func() {
+		stop()
+		stopDeadline()
+		cancel(nil)
+	}
+}
+
+// WithSecondaryContext makes processData also stop an item as soon as ctx is
+// done, on top of the context it was called with, as if the two had been
+// merged with MergeContexts. This suits a global shutdown context shared by
+// items that each run under their own request context.
+func WithSecondaryContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.secondary = ctx
+	}
+}
+
+// SplitDeadline divides the time left until ctx's deadline into parts
+// consecutive, equal slices, returning one child context per slice: child i
+// expires at the end of slice i. The time left is read from the Clock set by
+// WithClock in opts, which also decides when each child expires. Without a
+// parent deadline every child simply inherits ctx's cancellation. Each child
+// comes with its cancel function, at the same index, which the caller must
+// call once done with it. A parts of zero or less returns nil slices.
+func SplitDeadline(ctx context.Context, parts int, opts ...Option) ([]context.Context, []context.CancelFunc) {
+	if parts < 1 {
+		return nil, nil
+	}
+
+	ctxs := make([]context.Context, parts)
+	cancels := make([]context.CancelFunc, parts)
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		for i := range ctxs {
+			ctxs[i], cancels[i] = context.WithCancel(ctx)
+		}
+		return ctxs, cancels
+	}
+
+	clk := newOptions(opts).clk()
+	now := clk.Now()
+	slice := deadline.Sub(now) / time.Duration(parts)
+	for i := range ctxs {
+		end := now.Add(slice * time.Duration(i+1))
+		if i == parts-1 {
+			end = deadline
+		}
+		ctxs[i], cancels[i] = withDeadline(ctx, end, clk)
+	}
+	return ctxs, cancels
+}
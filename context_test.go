@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCorrelationIDPrefix(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for name, ctx := range map[string]context.Context{
+		"success":   context.Background(),
+		"cancelled": cancelled,
+	} {
+		t.Run(name, func(t *testing.T) {
+			log := new(captureLogger)
+			r := Classify(WithCorrelationID(ctx, "req-abc"), 42, WithNoDelay(), WithLogger(log))
+			if r.CorrelationID != "req-abc" {
+				t.Fatalf("CorrelationID = %q, want req-abc", r.CorrelationID)
+			}
+			lines := log.Lines()
+			if len(lines) == 0 {
+				t.Fatal("nothing logged")
+			}
+			for _, line := range lines {
+				if !strings.HasPrefix(line, "[req-abc] ") {
+					t.Errorf("line %q lacks the correlation ID", line)
+				}
+			}
+		})
+	}
+}
+
+func TestNoCorrelationIDNoPrefix(t *testing.T) {
+	log := new(captureLogger)
+	Classify(context.Background(), 42, WithNoDelay(), WithLogger(log))
+	for _, line := range log.Lines() {
+		if strings.HasPrefix(line, "[") {
+			t.Errorf("line %q has a prefix without a correlation ID", line)
+		}
+	}
+	if _, ok := CorrelationIDFromContext(context.Background()); ok {
+		t.Fatal("CorrelationIDFromContext found an ID in a bare context")
+	}
+}
+
+func TestSplitDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	parent, _ := ctx.Deadline()
+
+	ctxs, cancels := SplitDeadline(ctx, 3)
+	if len(ctxs) != 3 || len(cancels) != 3 {
+		t.Fatalf("got %d contexts and %d cancel funcs, want 3 of each", len(ctxs), len(cancels))
+	}
+	defer func() {
+		for _, c := range cancels {
+			c()
+		}
+	}()
+
+	var prev time.Time
+	for i, c := range ctxs {
+		d, ok := c.Deadline()
+		if !ok {
+			t.Fatalf("child %d has no deadline", i)
+		}
+		if i > 0 {
+			if gap := d.Sub(prev); gap < 90*time.Millisecond || gap > 110*time.Millisecond {
+				t.Errorf("child %d ends %v after child %d, want ~100ms", i, gap, i-1)
+			}
+		}
+		prev = d
+	}
+	if !prev.Equal(parent) {
+		t.Errorf("last child ends at %v, want the parent deadline %v", prev, parent)
+	}
+}
+
+func TestSplitDeadlineFakeClock(t *testing.T) {
+	c := newManualClock()
+	ctx, cancel := withDeadline(context.Background(), c.Now().Add(300*time.Millisecond), c)
+	defer cancel()
+
+	ctxs, cancels := SplitDeadline(ctx, 3, WithClock(c))
+	for i, child := range ctxs {
+		defer cancels[i]()
+		want := c.Now().Add(time.Duration(i+1) * 100 * time.Millisecond)
+		if d, ok := child.Deadline(); !ok || !d.Equal(want) {
+			t.Errorf("child %d deadline = (%v, %t), want %v on the fake clock", i, d, ok, want)
+		}
+	}
+
+	// The parent's timer and one per child.
+	waitFor(t, func() bool { return c.Waiters() == 4 })
+	for i, child := range ctxs {
+		c.Advance(100 * time.Millisecond)
+		select {
+		case <-child.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("child %d not done once the fake clock reached its deadline", i)
+		}
+		if i+1 < len(ctxs) && ctxs[i+1].Err() != nil {
+			t.Fatalf("child %d done before its deadline", i+1)
+		}
+	}
+}
+
+func TestSplitDeadlineNoDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctxs, cancels := SplitDeadline(ctx, 2)
+	for i, c := range ctxs {
+		if _, ok := c.Deadline(); ok {
+			t.Errorf("child %d has a deadline", i)
+		}
+		defer cancels[i]()
+	}
+	cancel()
+	for i, c := range ctxs {
+		if c.Err() == nil {
+			t.Errorf("child %d not cancelled with its parent", i)
+		}
+	}
+	if ctxs, cancels := SplitDeadline(ctx, 0); ctxs != nil || cancels != nil {
+		t.Error("SplitDeadline(ctx, 0) returned contexts")
+	}
+}
+
+func TestProcessOptionsVerbosePerItem(t *testing.T) {
+	// Both items share one Option slice, as the items of a batch do.
+	log := new(captureLogger)
+	opts := []Option{WithNoDelay(), WithLogger(log)}
+
+	Classify(WithProcessOptions(context.Background(), ProcessOptions{Verbose: true}), 1, opts...)
+	Classify(context.Background(), 2, opts...)
+
+	var details []string
+	for _, line := range log.Lines() {
+		if strings.HasPrefix(line, "Detail:") {
+			details = append(details, line)
+		}
+	}
+	if len(details) != 1 || !strings.Contains(details[0], "input 1 ") {
+		t.Errorf("detail lines = %q, want one for the verbose item only", details)
+	}
+}
+
+func TestProcessOptionsOverrideWorkDuration(t *testing.T) {
+	ctx := WithProcessOptions(context.Background(), ProcessOptions{WorkDuration: time.Millisecond})
+	start := time.Now()
+	r := Classify(ctx, 1, WithWorkDuration(time.Hour), WithLogger(nopLogger{}))
+	if r.Kind != KindInt || time.Since(start) > time.Second {
+		t.Errorf("Classify = %s after %v, want the context's 1ms work duration", r.Kind, time.Since(start))
+	}
+
+	// Zero fields leave the global options in place.
+	log := new(captureLogger)
+	Classify(WithProcessOptions(context.Background(), ProcessOptions{}), 1, WithNoDelay(), WithVerbose(), WithLogger(log))
+	if !log.contains("Detail:") {
+		t.Errorf("global WithVerbose lost under empty ProcessOptions, got %q", log.Lines())
+	}
+}
+
+type tenantKey struct{}
+
+// tenantFetcher fetches the tenant ID seeded in its context, and reports
+// whether the per-item deadline survived alongside it.
+type tenantFetcher struct{}
+
+func (tenantFetcher) Fetch(ctx context.Context) (string, error) {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	_, hasDeadline := ctx.Deadline()
+	return fmt.Sprintf("tenant=%s deadline=%t", tenant, hasDeadline), nil
+}
+
+func TestWithContextValuesVisibleToItems(t *testing.T) {
+	kv := map[interface{}]interface{}{tenantKey{}: "acme"}
+	opt := WithContextValues(kv)
+	kv[tenantKey{}] = "changed" // the option keeps its own copy
+
+	results := ProcessBatch(context.Background(), []interface{}{tenantFetcher{}, tenantFetcher{}},
+		opt, WithItemTimeout(time.Minute), WithNoDelay(), WithLogger(nopLogger{}))
+	for i, r := range results {
+		if want := "Processed Fetch: tenant=acme deadline=true"; r.Output != want {
+			t.Errorf("item %d: Output = %q, want %q", i, r.Output, want)
+		}
+	}
+}
+
+func TestWithContextValuesKeepsCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := Classify(ctx, 1, WithContextValues(map[interface{}]interface{}{tenantKey{}: "acme"}), WithNoDelay(), WithLogger(nopLogger{}))
+	if r.Kind != KindCancelled {
+		t.Errorf("Kind = %s, want the parent's cancellation to survive the values", r.Kind)
+	}
+}
+
+func TestMergeContextsCancelEither(t *testing.T) {
+	for _, first := range []string{"a", "b"} {
+		t.Run(first, func(t *testing.T) {
+			a, cancelA := context.WithCancelCause(context.Background())
+			defer cancelA(nil)
+			b, cancelB := context.WithCancelCause(context.Background())
+			defer cancelB(nil)
+			ctx, cancel := MergeContexts(a, b)
+			defer cancel()
+
+			cause := fmt.Errorf("%s cancelled", first)
+			if first == "a" {
+				cancelA(cause)
+			} else {
+				cancelB(cause)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+				t.Fatalf("merged context not done after cancelling %s", first)
+			}
+			if !errors.Is(ctx.Err(), context.Canceled) {
+				t.Errorf("Err() = %v, want context.Canceled", ctx.Err())
+			}
+			if got := context.Cause(ctx); got != cause {
+				t.Errorf("Cause() = %v, want %v", got, cause)
+			}
+		})
+	}
+}
+
+func TestMergeContextsKeepsEarlierCause(t *testing.T) {
+	a, cancelA := context.WithCancelCause(context.Background())
+	b, cancelB := context.WithCancelCause(context.Background())
+	ctx, cancel := MergeContexts(a, b)
+	defer cancel()
+
+	first := errors.New("b first")
+	cancelB(first)
+	<-ctx.Done()
+	cancelA(errors.New("a second"))
+	if got := context.Cause(ctx); got != first {
+		t.Errorf("Cause() = %v, want %v", got, first)
+	}
+}
+
+func TestMergeContextsEarlierDeadline(t *testing.T) {
+	a, cancelA := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelA()
+	b, cancelB := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelB()
+	ctx, cancel := MergeContexts(a, b)
+	defer cancel()
+
+	want, _ := b.Deadline()
+	if got, ok := ctx.Deadline(); !ok || !got.Equal(want) {
+		t.Errorf("Deadline() = (%v, %t), want b's %v", got, ok, want)
+	}
+	<-ctx.Done()
+	if !errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		t.Errorf("Cause() = %v, want context.DeadlineExceeded", context.Cause(ctx))
+	}
+}
+
+func TestMergeContextsNoLeak(t *testing.T) {
+	AssertNoGoroutineLeak(t, func() {
+		never := context.Background()
+		for i := 0; i < 100; i++ {
+			a, cancelA := context.WithCancel(context.Background())
+			ctx, cancel := MergeContexts(a, never)
+			cancelA()
+			<-ctx.Done()
+			cancel()
+
+			// Neither parent cancelled: cancel alone releases the context.
+			ctx, cancel = MergeContexts(never, never)
+			cancel()
+			<-ctx.Done()
+		}
+	})
+}
+
+func TestWithSecondaryContextStopsItem(t *testing.T) {
+	shutdown, stop := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, stop)
+
+	r := Classify(context.Background(), 42, WithWorkDuration(time.Hour), WithSecondaryContext(shutdown), WithLogger(nopLogger{}))
+	if r.Kind != KindCancelled || !errors.Is(r.Err, context.Canceled) {
+		t.Fatalf("Result = (%s, %v), want cancelled by the secondary context", r.Kind, r.Err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Drain consumes results until the channel is closed or ctx is cancelled,
+// and reports how many Results it saw and how many of them carried an Err.
+// It returns as soon as ctx is cancelled, even while the producer is slow,
+// so a nil results channel simply blocks until then.
+func Drain(ctx context.Context, results <-chan Result) (total int, errs int) {
+	for {
+		select {
+		case <-ctx.Done():
+			return total, errs
+		case r, ok := <-results:
+			if !ok {
+				return total, errs
+			}
+			total++
+			if r.Err != nil {
+				errs++
+			}
+		}
+	}
+}
+
+// ErrDrainTimeout is returned by DrainWithTimeout when the producer stalls.
+var ErrDrainTimeout = errors.New("no result within the drain timeout")
+
+// DrainWithTimeout collects results until the channel is closed, returning
+// them with a nil error. If no Result arrives for perItemTimeout, counted
+// afresh after every Result received, it gives up and returns what it has
+// collected so far together with an error wrapping ErrDrainTimeout.
+func DrainWithTimeout(results <-chan Result, perItemTimeout time.Duration) ([]Result, error) {
+	var collected []Result
+
+	t := time.NewTimer(perItemTimeout)
+	defer t.Stop()
+
+	for {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				return collected, nil
+			}
+			collected = append(collected, r)
+			t.Reset(perItemTimeout)
+		case <-t.C:
+			return collected, fmt.Errorf("%w: stalled for %v after %d results", ErrDrainTimeout, perItemTimeout, len(collected))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDrainClosedChannel(t *testing.T) {
+	ch := make(chan Result, 4)
+	ch <- Result{Input: 1}
+	ch <- Result{Input: 2, Err: ErrUnsupportedType}
+	ch <- Result{Input: 3}
+	ch <- Result{Input: 4, Err: ErrContextCancelled}
+	close(ch)
+
+	if total, errs := Drain(context.Background(), ch); total != 4 || errs != 2 {
+		t.Fatalf("Drain = (%d, %d), want (4, 2)", total, errs)
+	}
+}
+
+func TestDrainCancelled(t *testing.T) {
+	for name, ch := range map[string]chan Result{"slow producer": make(chan Result), "nil channel": nil} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				if total, errs := Drain(ctx, ch); total != 0 || errs != 0 {
+					t.Errorf("Drain = (%d, %d), want (0, 0)", total, errs)
+				}
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Drain did not return after cancellation")
+			}
+		})
+	}
+}
+
+func TestDrainWithTimeoutClosed(t *testing.T) {
+	ch := make(chan Result, 3)
+	for i := 0; i < 3; i++ {
+		ch <- Result{Input: i}
+	}
+	close(ch)
+
+	got, err := DrainWithTimeout(ch, time.Second)
+	if err != nil || len(got) != 3 {
+		t.Fatalf("DrainWithTimeout = (%d results, %v), want (3, nil)", len(got), err)
+	}
+}
+
+func TestDrainWithTimeoutStalled(t *testing.T) {
+	ch := make(chan Result, 2)
+	ch <- Result{Input: 1}
+	ch <- Result{Input: 2}
+
+	got, err := DrainWithTimeout(ch, 20*time.Millisecond)
+	if !errors.Is(err, ErrDrainTimeout) {
+		t.Errorf("err = %v, want ErrDrainTimeout", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("collected %d results before the stall, want 2", len(got))
+	}
+}
+
+func TestDrainWithTimeoutResetsPerResult(t *testing.T) {
+	// The producer takes longer in total than the timeout, but never stalls
+	// for longer than it between two Results.
+	ch := make(chan Result)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 5; i++ {
+			time.Sleep(25 * time.Millisecond)
+			ch <- Result{Input: i}
+		}
+	}()
+
+	got, err := DrainWithTimeout(ch, 60*time.Millisecond)
+	if err != nil || len(got) != 5 {
+		t.Fatalf("DrainWithTimeout = (%d results, %v), want (5, nil)", len(got), err)
+	}
+}
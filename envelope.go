@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Envelope carries a payload together with metadata about where it came
+// from and when it was queued.
+type Envelope struct {
+	Data       interface{}
+	Meta       map[string]string
+	EnqueuedAt time.Time
+}
+
+// ProcessEnvelope is processData for env.Data: the type switch sees the
+// payload, not the Envelope. The Result additionally carries a copy of
+// env.Meta and how long the payload waited between env.EnqueuedAt and the
+// start of processing, measured with the configured Clock.
+func ProcessEnvelope(ctx context.Context, wg *sync.WaitGroup, env Envelope, out chan<- Result, opts ...Option) error {
+	return processData(ctx, wg, env.Data, out, append(opts[:len(opts):len(opts)], withEnvelope(env))...)
+}
+
+// withEnvelope makes classify record env's metadata on the Result.
+func withEnvelope(env Envelope) Option {
+	return func(o *options) {
+		o.envelope = &env
+		o.enqueuedAt = env.EnqueuedAt
+	}
+}
+
+// withEnqueuedAt makes classify record that the item was queued at t.
+func withEnqueuedAt(t time.Time) Option {
+	return func(o *options) {
+		o.enqueuedAt = t
+	}
+}
+
+// stamp records on r that processing started at start, along with when the
+// item was queued and the metadata of the Envelope being processed, if
+// known. Meta is copied so the Result never shares the caller's map.
+func (o *options) stamp(r *Result, start time.Time) {
+	r.StartedAt = start
+	if !o.enqueuedAt.IsZero() {
+		r.EnqueuedAt = o.enqueuedAt
+		r.QueueWait = start.Sub(o.enqueuedAt)
+	}
+
+	if env := o.envelope; env != nil && env.Meta != nil {
+		r.Meta = make(map[string]string, len(env.Meta))
+		for k, v := range env.Meta {
+			r.Meta[k] = v
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessEnvelope(t *testing.T) {
+	c := newManualClock()
+	enqueued := c.Now()
+	c.Advance(250 * time.Millisecond)
+
+	meta := map[string]string{"source": "queue-a"}
+	out := make(chan Result, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	err := ProcessEnvelope(context.Background(), &wg, Envelope{Data: 42, Meta: meta, EnqueuedAt: enqueued}, out,
+		WithClock(c), WithNoDelay(), WithLogger(nopLogger{}))
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("ProcessEnvelope: %v", err)
+	}
+
+	r := <-out
+	if r.Kind != KindInt || r.Input != 42 {
+		t.Errorf("Result = (%s, %v), want the int payload", r.Kind, r.Input)
+	}
+	if r.QueueWait != 250*time.Millisecond {
+		t.Errorf("QueueWait = %v, want 250ms", r.QueueWait)
+	}
+	if r.Meta["source"] != "queue-a" {
+		t.Errorf("Meta = %v, want source=queue-a", r.Meta)
+	}
+
+	meta["source"] = "changed"
+	if r.Meta["source"] != "queue-a" {
+		t.Error("Result.Meta shares the Envelope's map")
+	}
+}
+
+func TestProcessEnvelopeNoEnqueuedAt(t *testing.T) {
+	out := make(chan Result, 1)
+	ProcessEnvelope(context.Background(), nil, Envelope{Data: "Alpha"}, out, WithNoDelay(), WithLogger(nopLogger{}))
+	if r := <-out; r.QueueWait != 0 || r.Meta != nil {
+		t.Errorf("Result = (wait %v, meta %v), want neither", r.QueueWait, r.Meta)
+	}
+}
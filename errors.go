@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// UnsupportedTypeError is the error processData returns for a payload the
+// type switch does not handle and no registered handler accepts. It matches
+// ErrUnsupportedType under errors.Is.
+type UnsupportedTypeError struct {
+	Type reflect.Type // dynamic type of the payload
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrUnsupportedType, e.Type)
+}
+
+// Unwrap returns ErrUnsupportedType.
+func (e *UnsupportedTypeError) Unwrap() error {
+	return ErrUnsupportedType
+}
+
+// PayloadTooLargeError is the error processData returns for a payload
+// rejected by WithMaxPayloadBytes. It matches ErrPayloadTooLarge under
+// errors.Is.
+type PayloadTooLargeError struct {
+	Size int // length of the payload, in bytes
+	Max  int // limit set by WithMaxPayloadBytes
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("%v: %d bytes, limit %d", ErrPayloadTooLarge, e.Size, e.Max)
+}
+
+// Unwrap returns ErrPayloadTooLarge.
+func (e *PayloadTooLargeError) Unwrap() error {
+	return ErrPayloadTooLarge
+}
+
+// OptionError reports an Option given a value it cannot honour. Validate,
+// Run, RunGroup and the WorkerPool constructors return one per invalid
+// Option, joined with errors.Join, as does the Err of a Result processed
+// under invalid options. It matches ErrInvalidOption under errors.Is.
+type OptionError struct {
+	Option string      // Option constructor, e.g. "WithRateLimit", or function given the value
+	Value  interface{} // offending value
+	Reason string      // what is wrong with it
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("%v: %s(%v): %s", ErrInvalidOption, e.Option, e.Value, e.Reason)
+}
+
+// Unwrap returns ErrInvalidOption.
+func (e *OptionError) Unwrap() error {
+	return ErrInvalidOption
+}
+
+// StrictTypeError is the value processData panics with under WithStrictTypes
+// when the payload's type is unsupported. The panic is recovered like any
+// other, so the Result's *PanicError wraps it, and errors.As can tell a
+// strict-mode failure from any other panic. It matches ErrUnsupportedType
+// under errors.Is.
+type StrictTypeError struct {
+	Type reflect.Type // dynamic type of the payload
+}
+
+func (e *StrictTypeError) Error() string {
+	return fmt.Sprintf("strict types: %v: %v", ErrUnsupportedType, e.Type)
+}
+
+// Unwrap returns ErrUnsupportedType.
+func (e *StrictTypeError) Unwrap() error {
+	return ErrUnsupportedType
+}
+
+// CancelledError is the error processData returns when the context is done
+// before the item is processed. Cause is context.Cause(ctx), so errors.Is
+// matches both ErrContextCancelled and context.DeadlineExceeded,
+// context.Canceled or the custom cancellation cause.
+type CancelledError struct {
+	Cause error
+}
+
+func (e *CancelledError) Error() string {
+	if e.Cause == nil {
+		return ErrContextCancelled.Error()
+	}
+	return fmt.Sprintf("%v: %v", ErrContextCancelled, e.Cause)
+}
+
+// Unwrap returns ErrContextCancelled and, if set, Cause.
+func (e *CancelledError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{ErrContextCancelled}
+	}
+	return []error{ErrContextCancelled, e.Cause}
+}
+
+// PanicError is the error processData returns when processing a payload
+// panics. It matches ErrProcessingPanic under errors.Is.
+type PanicError struct {
+	Value interface{} // value passed to panic
+	Stack []byte      // stack of the panicking goroutine, as captured by debug.Stack
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrProcessingPanic, e.Value)
+}
+
+// Unwrap returns ErrProcessingPanic, or the panic value itself when it is an
+// error, which then wraps ErrProcessingPanic as well.
+func (e *PanicError) Unwrap() []error {
+	if err, ok := e.Value.(error); ok {
+		return []error{ErrProcessingPanic, err}
+	}
+	return []error{ErrProcessingPanic}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUnsupportedTypeErrorAs(t *testing.T) {
+	err := processData(context.Background(), nil, map[string]bool{}, nil, WithNoDelay(), WithLogger(nopLogger{}))
+	var uerr *UnsupportedTypeError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("err = %v, want an *UnsupportedTypeError", err)
+	}
+	if uerr.Type != reflect.TypeFor[map[string]bool]() {
+		t.Fatalf("Type = %v, want map[string]bool", uerr.Type)
+	}
+	if uerr.Error() != "unsupported type: map[string]bool" {
+		t.Fatalf("Error() = %q", uerr.Error())
+	}
+}
+
+func TestCancelledErrorAs(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cause := errors.New("caller went away")
+	cancel(cause)
+
+	err := processData(ctx, nil, 1, nil, WithLogger(nopLogger{}))
+	var cerr *CancelledError
+	if !errors.As(err, &cerr) || cerr.Cause != cause {
+		t.Fatalf("err = %v, want a *CancelledError with the cause", err)
+	}
+	if !errors.Is(err, ErrContextCancelled) || !errors.Is(err, cause) {
+		t.Fatalf("err = %v, want it to match ErrContextCancelled and the cause", err)
+	}
+	if (&CancelledError{}).Error() != ErrContextCancelled.Error() {
+		t.Fatal("a CancelledError without a cause is not reported as the sentinel")
+	}
+}
+
+func TestPanicErrorAs(t *testing.T) {
+	boom := errors.New("boom")
+	err := processData(context.Background(), nil, panicFetcher{boom}, nil, WithNoDelay(), WithLogger(nopLogger{}))
+	var perr *PanicError
+	if !errors.As(err, &perr) || perr.Value != boom {
+		t.Fatalf("err = %v, want a *PanicError carrying the value", err)
+	}
+	if !errors.Is(err, ErrProcessingPanic) || !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want it to match ErrProcessingPanic and the panicked error", err)
+	}
+}
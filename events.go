@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is one processing decision recorded in an EventLog.
+type Event struct {
+	Seq       uint64    // position in the log, increasing across all items
+	Time      time.Time // when the event happened, by the configured Clock
+	ItemIndex int       // index of the item in its batch, -1 if unknown
+	Kind      string    // "enqueued", "started", "classified:<Result.Kind>", "cancelled" or "completed"
+}
+
+// eventShards is the number of independently locked slices an EventLog
+// spreads its events over, so concurrent workers rarely contend.
+const eventShards = 16
+
+// EventLog is an ordered record of the decisions processData makes, for
+// replaying a nondeterministic run after the fact. Each event takes its
+// sequence number from an atomic counter, then lands in one of several
+// shards picked by that number, so appends from many goroutines seldom
+// wait on one another. The zero value is ready to use.
+type EventLog struct {
+	seq    uint64
+	shards [eventShards]struct {
+		mu     sync.Mutex
+		events []Event
+	}
+}
+
+// WithEventLog makes Run, Dispatch, WorkerPool and processData record their
+// decisions in l. Items dispatched by Run and Dispatch are indexed by their
+// position in the batch, items submitted to a WorkerPool by submission
+// order.
+func WithEventLog(l *EventLog) Option {
+	return func(o *options) {
+		o.events = l
+	}
+}
+
+// append records an event of kind for item at t. It is a no-op on a nil
+// EventLog.
+func (l *EventLog) append(t time.Time, item int, kind string) {
+	if l == nil {
+		return
+	}
+
+	e := Event{Seq: atomic.AddUint64(&l.seq, 1), Time: t, ItemIndex: item, Kind: kind}
+	shard := &l.shards[e.Seq%eventShards]
+	shard.mu.Lock()
+	shard.events = append(shard.events, e)
+	shard.mu.Unlock()
+}
+
+// Events returns a copy of every event recorded so far, sorted by Seq.
+func (l *EventLog) Events() []Event {
+	var events []Event
+	for i := range l.shards {
+		shard := &l.shards[i]
+		shard.mu.Lock()
+		events = append(events, shard.events...)
+		shard.mu.Unlock()
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Seq < events[j].Seq })
+	return events
+}
+
+// record appends an event for the item processed under ctx.
+func (o *options) record(ctx context.Context, kind string) {
+	if o.events == nil {
+		return
+	}
+	o.events.append(o.clk().Now(), itemIndexFromContext(ctx), kind)
+}
+
+// withItemIndex returns a copy of ctx carrying the index of its item, when
+// there is an EventLog or a WithOnTransition callback to label with it.
+func (o *options) withItemIndex(ctx context.Context, i int) context.Context {
+	if o.events == nil && o.onTransition == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, itemIndexKey, i)
+}
+
+// itemIndexFromContext returns the item index stored by withItemIndex, or
+// -1 without one.
+func itemIndexFromContext(ctx context.Context) int {
+	if i, ok := ctx.Value(itemIndexKey).(int); ok {
+		return i
+	}
+	return -1
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventLogStartedAndTerminalPerItem(t *testing.T) {
+	l := new(EventLog)
+	items := []interface{}{"Alpha", 42, true, Order{}}
+	if _, err := Run(WithItems(items...), WithNoDelay(), WithEventLog(l), WithLogger(nopLogger{})); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	events := l.Events()
+	started := make(map[int]uint64)
+	terminal := make(map[int]uint64)
+	for i, e := range events {
+		if i > 0 && e.Seq <= events[i-1].Seq {
+			t.Fatalf("event %d has Seq %d after %d", i, e.Seq, events[i-1].Seq)
+		}
+		switch e.Kind {
+		case "started":
+			started[e.ItemIndex] = e.Seq
+		case "completed", "cancelled":
+			terminal[e.ItemIndex] = e.Seq
+		}
+	}
+	for i := range items {
+		s, ok := started[i]
+		if !ok {
+			t.Errorf("item %d has no started event", i)
+			continue
+		}
+		if e, ok := terminal[i]; !ok || e < s {
+			t.Errorf("item %d has no terminal event after it started", i)
+		}
+	}
+}
+
+func TestEventLogCancelled(t *testing.T) {
+	l := new(EventLog)
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	Classify(ctx, 1, WithNoDelay(), WithEventLog(l), WithLogger(nopLogger{}))
+
+	var kinds []string
+	for _, e := range l.Events() {
+		kinds = append(kinds, e.Kind)
+	}
+	if len(kinds) == 0 || kinds[len(kinds)-1] != "cancelled" {
+		t.Errorf("events = %q, want a cancelled event last", kinds)
+	}
+}
+
+func TestEventLogConcurrentAppends(t *testing.T) {
+	l := new(EventLog)
+	const n = 200
+	items := make([]interface{}, n)
+	for i := range items {
+		items[i] = i
+	}
+	if _, err := Run(WithItems(items...), WithNoDelay(), WithTimeout(time.Minute), WithEventLog(l), WithLogger(nopLogger{})); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	events := l.Events()
+	for i, e := range events {
+		if e.Seq != uint64(i+1) {
+			t.Fatalf("event %d has Seq %d, want an unbroken sequence", i, e.Seq)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// FanIn merges chans into a single channel. The returned channel is closed
+// once every input has been drained, or as soon as ctx is cancelled, and no
+// forwarding goroutine outlives that point. With no inputs the returned
+// channel is already closed; with one input its Results are forwarded
+// unchanged and in order.
+func FanIn(ctx context.Context, chans ...<-chan Result) <-chan Result {
+	out := make(chan Result)
+
+	var wg sync.WaitGroup
+	for _, ch := range chans {
+		wg.Add(1)
+		go func(ch <-chan Result) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case r, ok := <-ch:
+					if !ok {
+						return
+					}
+					select {
+					case out <- r:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}(ch)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
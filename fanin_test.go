@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFanInCancelNoLeak(t *testing.T) {
+	AssertNoGoroutineLeak(t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// Neither input is ever closed, and the first has a Result nobody
+		// reads, so only the cancellation can stop the forwarders.
+		a, b := make(chan Result, 1), make(chan Result)
+		a <- Result{Input: 1}
+		out := FanIn(ctx, a, b)
+
+		waitFor(t, func() bool { return len(a) == 0 })
+		cancel()
+		select {
+		case _, ok := <-out:
+			for ok {
+				_, ok = <-out
+			}
+		case <-time.After(time.Second):
+			t.Fatal("FanIn output not closed after cancellation")
+		}
+	})
+}
+
+func TestFanInForwardsInOrder(t *testing.T) {
+	in := make(chan Result, 3)
+	for i := 0; i < 3; i++ {
+		in <- Result{Input: i}
+	}
+	close(in)
+
+	i := 0
+	for r := range FanIn(context.Background(), in) {
+		if r.Input != i {
+			t.Fatalf("Result %d has Input %v", i, r.Input)
+		}
+		i++
+	}
+	if i != 3 {
+		t.Fatalf("got %d Results, want 3", i)
+	}
+}
+
+func TestFanInNoInputs(t *testing.T) {
+	if _, ok := <-FanIn(context.Background()); ok {
+		t.Fatal("FanIn() output not closed")
+	}
+}
+
+func TestFanInMergesThree(t *testing.T) {
+	var chans []<-chan Result
+	for c := 0; c < 3; c++ {
+		ch := make(chan Result)
+		chans = append(chans, ch)
+		go func(c int) {
+			defer close(ch)
+			for i := 0; i < 10; i++ {
+				ch <- Result{Input: c*10 + i}
+			}
+		}(c)
+	}
+
+	seen := make(map[interface{}]bool)
+	for r := range FanIn(context.Background(), chans...) {
+		seen[r.Input] = true
+	}
+	for i := 0; i < 30; i++ {
+		if !seen[i] {
+			t.Errorf("value %d did not arrive", i)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// fastPaths maps the concrete payload types the type switch in classify
+// has a case for to the functions filling in their Result, for callers that
+// only learn a payload's type at run time, such as the WithFallbackDecoder
+// path, so they can skip a second trip through the switch. The switch cases
+// call the same functions, so both paths report identically. It is
+// populated by init and only read after that, so it needs no locking.
+var fastPaths map[reflect.Type]func(o *options, v interface{}, res *Result)
+
+func init() {
+	fastPaths = map[reflect.Type]func(o *options, v interface{}, res *Result){
+		reflect.TypeFor[string]():  processString,
+		reflect.TypeFor[int]():     processInt,
+		reflect.TypeFor[bool]():    processBool,
+		reflect.TypeFor[float64](): processFloat,
+		reflect.TypeFor[[]byte]():  processBytes,
+	}
+}
+
+func processString(o *options, v interface{}, res *Result) {
+	res.Kind = KindString
+	res.Length = o.stringLength(v.(string))
+	res.Output = fmt.Sprintf("Processed String: %s (length %d)", v, res.Length)
+}
+
+func processInt(_ *options, v interface{}, res *Result) {
+	res.Kind = KindInt
+	res.Output = fmt.Sprintf("Processed Int: %d", v)
+}
+
+func processBool(_ *options, v interface{}, res *Result) {
+	res.Kind = KindBool
+	res.Output = fmt.Sprintf("Processed Bool: %t", v)
+}
+
+func processFloat(_ *options, v interface{}, res *Result) {
+	res.Kind = KindFloat
+	res.Output = fmt.Sprintf("Processed Float: %.2f", v)
+}
+
+func processBytes(_ *options, v interface{}, res *Result) {
+	b := v.([]byte)
+	res.Kind = KindBytes
+	res.Length = len(b)
+	res.RuneLength = utf8.RuneCount(b)
+	if utf8.Valid(b) {
+		res.Output = fmt.Sprintf("Processed Bytes: %d bytes (%d runes)", res.Length, res.RuneLength)
+	} else {
+		res.Output = fmt.Sprintf("Processed Bytes: %d bytes (%d runes, invalid utf-8)", res.Length, res.RuneLength)
+	}
+}
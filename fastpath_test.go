@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// celsius has a common underlying type but no fast path, so it takes the
+// reflect-based unknown-type branch.
+type celsius float64
+
+func TestClassifyFastPaths(t *testing.T) {
+	tests := []struct {
+		data interface{}
+		kind Kind
+		out  string
+	}{
+		{"Alpha", KindString, "Processed String: Alpha (length 5)"},
+		{42, KindInt, "Processed Int: 42"},
+		{true, KindBool, "Processed Bool: true"},
+		{3.14159, KindFloat, "Processed Float: 3.14"},
+		{[]byte("hé"), KindBytes, "Processed Bytes: 3 bytes (2 runes)"},
+		{[]byte{0xff}, KindBytes, "Processed Bytes: 1 bytes (1 runes, invalid utf-8)"},
+		{celsius(1), KindUnknown, "Unknown type encountered: main.celsius (kind: float64)"},
+	}
+	for _, tt := range tests {
+		r := Classify(context.Background(), tt.data, WithNoDelay(), WithLogger(nopLogger{}))
+		if r.Kind != tt.kind || r.Output != tt.out {
+			t.Errorf("Classify(%#v) = (%s, %q), want (%s, %q)", tt.data, r.Kind, r.Output, tt.kind, tt.out)
+		}
+	}
+}
+
+func TestCommonTypesTakeTheirOwnCase(t *testing.T) {
+	// With the table emptied, only the type switch cases can handle them.
+	saved := fastPaths
+	fastPaths = nil
+	defer func() { fastPaths = saved }()
+
+	for _, data := range []interface{}{"Alpha", 42, true, 2.5, []byte("hi")} {
+		r := Classify(context.Background(), data, WithNoDelay(), WithLogger(nopLogger{}))
+		if r.Kind == KindUnknown || r.Err != nil {
+			t.Errorf("Classify(%#v) = (%s, %v), want its own case", data, r.Kind, r.Err)
+		}
+	}
+}
+
+func TestFallbackDecodedUsesFastPath(t *testing.T) {
+	decode := func(v interface{}) (interface{}, bool) {
+		w, ok := v.(wrapped)
+		return w.v, ok
+	}
+	for _, data := range []interface{}{"Alpha", 42, true, 3.14159, []byte("hé")} {
+		want := Classify(context.Background(), data, WithNoDelay(), WithLogger(nopLogger{}))
+		r := Classify(context.Background(), wrapped{data}, WithFallbackDecoder(decode), WithNoDelay(), WithLogger(nopLogger{}))
+		if r.Kind != want.Kind || r.Output != want.Output {
+			t.Errorf("decoded %#v = (%s, %q), want (%s, %q) as from its case", data, r.Kind, r.Output, want.Kind, want.Output)
+		}
+	}
+}
+
+func BenchmarkClassifyCommonTypes(b *testing.B) {
+	o := newOptions([]Option{WithNoDelay(), WithLogger(nopLogger{})})
+	ctx := context.Background()
+	for _, data := range []interface{}{"Alpha", 42, true, 2.5, []byte("bytes")} {
+		b.Run(fmt.Sprintf("%T", data), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				classify(ctx, data, o)
+			}
+		})
+	}
+}
+
+func BenchmarkClassifyReflectPath(b *testing.B) {
+	o := newOptions([]Option{WithNoDelay(), WithLogger(nopLogger{})})
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		classify(ctx, celsius(2.5), o)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// WithFilter makes Run, Dispatch and the other dispatching helpers skip
+// every item pred returns false for: instead of being processed, it is
+// reported straight away as a Kind "filtered" Result, counted in
+// Stats.Filtered and handed to the sink, without a goroutine, context or
+// rate limit token being spent on it. A nil pred, the default, filters
+// nothing.
+func WithFilter(pred func(interface{}) bool) Option {
+	return func(o *options) {
+		o.filter = pred
+	}
+}
+
+// filteredOut reports whether WithFilter rejects data.
+func (o *options) filteredOut(data interface{}) bool {
+	return o.filter != nil && !o.filter(data)
+}
+
+// reportFiltered delivers the Result of data, rejected by WithFilter, on
+// results.
+func (o *options) reportFiltered(ctx context.Context, data interface{}, results chan<- Result) {
+	res := Result{
+		Input:      data,
+		Kind:       KindFiltered,
+		Output:     fmt.Sprintf("Filtered data: %v", data),
+		FinishedAt: o.clk().Now(),
+	}
+	o.stats.filtered()
+	o.types.record(data)
+	o.emit(res)
+	o.deliver(ctx, results, res)
+}
+
+// filtered counts one item rejected by WithFilter. It is a no-op on a nil
+// Stats.
+func (s *Stats) filtered() {
+	if s == nil {
+		return
+	}
+
+	atomic.AddInt64(&s.Filtered, 1)
+	s.mu.Lock()
+	if s.kinds == nil {
+		s.kinds = make(map[string]int64)
+	}
+	s.kinds[KindFiltered.String()]++
+	s.mu.Unlock()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+// notInt is a WithFilter predicate rejecting every int.
+func notInt(data interface{}) bool {
+	_, ok := data.(int)
+	return !ok
+}
+
+func TestWithFilterRejectsInts(t *testing.T) {
+	stats := new(Stats)
+	sink := new(recordingSink)
+	results, err := Run(WithItems("a", 1, "b", 2), WithFilter(notInt), WithStats(stats), WithSink(sink),
+		WithNoDelay(), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d Results, want 4", len(results))
+	}
+	for _, r := range results {
+		want := KindString
+		if _, ok := r.Input.(int); ok {
+			want = KindFiltered
+		}
+		if r.Kind != want || r.Err != nil {
+			t.Errorf("item %v = (%s, %v), want %s", r.Input, r.Kind, r.Err, want)
+		}
+	}
+	if got := atomic.LoadInt64(&stats.Filtered); got != 2 {
+		t.Errorf("Stats.Filtered = %d, want 2", got)
+	}
+	if got := len(sink.Results()); got != 4 {
+		t.Errorf("sink got %d Results, want all 4", got)
+	}
+}
+
+func TestWithFilterSkipsWork(t *testing.T) {
+	log := new(captureLogger)
+	wg := Dispatch(context.Background(), []interface{}{1, "a", 2}, WithFilter(notInt), WithOrderedOutput(),
+		WithNoDelay(), WithLogger(log))
+	wg.Wait()
+
+	// Filtered items release their place in the ordered output but never
+	// reach the type switch.
+	got := processedLines(log)
+	if len(got) != 1 || got[0] != "Processed String: a (length 1)" {
+		t.Errorf("processed %q, want only the string", got)
+	}
+}
+
+func TestWithFilterNil(t *testing.T) {
+	results, err := Run(WithItems(1, "a"), WithFilter(nil), WithNoDelay(), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, r := range results {
+		if r.Kind == KindFiltered {
+			t.Errorf("item %v filtered by a nil predicate", r.Input)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// Processor turns a payload of a known type into its processed output.
+type Processor[T any] interface {
+	Process(data T) string
+}
+
+// ProcessorFunc adapts an ordinary function to the Processor interface.
+type ProcessorFunc[T any] func(data T) string
+
+// Process calls f(data).
+func (f ProcessorFunc[T]) Process(data T) string {
+	return f(data)
+}
+
+// StringProcessor is the Processor used for string payloads.
+type StringProcessor struct{}
+
+// Process formats s the same way processData does.
+func (StringProcessor) Process(s string) string {
+	return fmt.Sprintf("Processed String: %s (length %d)", s, len(s))
+}
+
+// IntProcessor is the Processor used for int payloads.
+type IntProcessor struct{}
+
+// Process formats n the same way processData does.
+func (IntProcessor) Process(n int) string {
+	return fmt.Sprintf("Processed Int: %d", n)
+}
+
+// ErrNilProcessor is the error ProcessTyped and ProcessTypedResult return
+// when they are given a nil Processor.
+var ErrNilProcessor = errors.New("nil processor")
+
+// TypedResult is the outcome of ProcessTypedResult. Unlike Result it keeps
+// the payload as its static type T, avoiding the interface{} boxing.
+type TypedResult[T any] struct {
+	Input  T
+	Output string
+	Err    error
+}
+
+// ProcessTyped is the compile-time typed counterpart of processData. It runs
+// the same context/timeout select, but the type switch is replaced by p, which
+// is chosen by the caller for the payload type T. A nil ctx is treated as
+// context.Background().
+func ProcessTyped[T any](ctx context.Context, wg *sync.WaitGroup, data T, p Processor[T], opts ...Option) error {
+	defer signalDone(wg)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return classifyTyped(ctx, data, p, newOptions(opts)).Err
+}
+
+// ProcessTypedResult is ProcessTyped delivering its TypedResult on out. Like
+// processData, the send gives up when ctx is done rather than blocking a
+// cancelled worker, and a nil out discards the result.
+func ProcessTypedResult[T any](ctx context.Context, wg *sync.WaitGroup, data T, p Processor[T], out chan<- TypedResult[T], opts ...Option) {
+	defer signalDone(wg)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	res := classifyTyped(ctx, data, p, newOptions(opts))
+	if out == nil {
+		return
+	}
+
+	select {
+	case out <- res:
+		return
+	default:
+	}
+
+	select {
+	case out <- res:
+	case <-ctx.Done():
+	}
+}
+
+// classifyTyped runs the context/timeout select for a typed payload.
+func classifyTyped[T any](ctx context.Context, data T, p Processor[T], o *options) (res TypedResult[T]) {
+	res.Input = data
+
+	if p == nil {
+		res.Err = ErrNilProcessor
+		return res
+	}
+
+	// Recover from a panic in p the way processData does, so a bad
+	// Processor cannot take down the program or leave wg unsignalled.
+	defer func() {
+		if r := recover(); r != nil {
+			res.Output = fmt.Sprintf("recovered from panic processing data: %v", r)
+			res.Err = &PanicError{Value: r, Stack: debug.Stack()}
+			o.log().Logf("%s", res.Output)
+		}
+	}()
+
+	if err := o.sleep(ctx, o.work()); err != nil {
+		res.Output = fmt.Sprintf("Context cancelled for data: %v", data)
+		res.Err = &CancelledError{Cause: context.Cause(ctx)}
+	} else {
+		res.Output = p.Process(data)
+	}
+
+	o.log().Logf("%s", res.Output)
+	return res
+}
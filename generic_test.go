@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessTypedNilContext(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	if err := ProcessTyped[int](nil, &wg, 1, IntProcessor{}, WithNoDelay(), WithLogger(nopLogger{})); err != nil {
+		t.Fatalf("ProcessTyped: %v", err)
+	}
+	out := make(chan TypedResult[string], 1)
+	ProcessTypedResult[string](nil, &wg, "a", StringProcessor{}, out, WithNoDelay(), WithLogger(nopLogger{}))
+	wg.Wait()
+	if r := <-out; r.Err != nil || r.Output != "Processed String: a (length 1)" {
+		t.Fatalf("ProcessTypedResult = %+v", r)
+	}
+}
+
+func TestProcessTypedCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ProcessTyped[int](ctx, nil, 1, IntProcessor{}, WithLogger(nopLogger{}))
+	if !errors.Is(err, ErrContextCancelled) {
+		t.Fatalf("err = %v, want ErrContextCancelled", err)
+	}
+}
+
+func TestProcessTypedNilProcessor(t *testing.T) {
+	err := ProcessTyped[int](context.Background(), nil, 1, nil, WithNoDelay(), WithLogger(nopLogger{}))
+	if !errors.Is(err, ErrNilProcessor) {
+		t.Fatalf("err = %v, want ErrNilProcessor", err)
+	}
+}
+
+func TestProcessTypedRecoversPanic(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	p := ProcessorFunc[int](func(int) string { panic("boom") })
+	out := make(chan TypedResult[int], 1)
+	ProcessTypedResult[int](context.Background(), &wg, 7, p, out, WithNoDelay(), WithLogger(nopLogger{}))
+	wg.Wait()
+
+	r := <-out
+	var perr *PanicError
+	if !errors.As(r.Err, &perr) || perr.Value != "boom" || len(perr.Stack) == 0 {
+		t.Fatalf("Err = %v, want *PanicError for boom with a stack", r.Err)
+	}
+	if !errors.Is(r.Err, ErrProcessingPanic) {
+		t.Fatalf("Err = %v, want it to match ErrProcessingPanic", r.Err)
+	}
+	if r.Input != 7 {
+		t.Fatalf("Input = %d, want 7", r.Input)
+	}
+}
+
+type point struct{ X, Y int }
+
+func TestProcessTypedTypes(t *testing.T) {
+	opts := []Option{WithNoDelay(), WithLogger(nopLogger{})}
+	if err := ProcessTyped[int](context.Background(), nil, 42, IntProcessor{}, opts...); err != nil {
+		t.Errorf("ProcessTyped[int]: %v", err)
+	}
+	if err := ProcessTyped[string](context.Background(), nil, "Alpha", StringProcessor{}, opts...); err != nil {
+		t.Errorf("ProcessTyped[string]: %v", err)
+	}
+
+	out := make(chan TypedResult[point], 1)
+	p := ProcessorFunc[point](func(pt point) string { return fmt.Sprintf("Processed Point: %d,%d", pt.X, pt.Y) })
+	ProcessTypedResult[point](context.Background(), nil, point{1, 2}, p, out, opts...)
+	if r := <-out; r.Err != nil || r.Input != (point{1, 2}) || r.Output != "Processed Point: 1,2" {
+		t.Errorf("ProcessTypedResult[point] = %+v", r)
+	}
+}
+
+func TestProcessTypedResultInts(t *testing.T) {
+	out := make(chan TypedResult[int], 3)
+	var wg sync.WaitGroup
+	for _, n := range []int{1, 2, 3} {
+		wg.Add(1)
+		go ProcessTypedResult[int](context.Background(), &wg, n, IntProcessor{}, out, WithNoDelay(), WithLogger(nopLogger{}))
+	}
+	wg.Wait()
+	close(out)
+
+	sum := 0
+	for r := range out {
+		// Input is statically an int: no type assertion needed.
+		sum += r.Input
+		if r.Output != fmt.Sprintf("Processed Int: %d", r.Input) {
+			t.Errorf("Output = %q", r.Output)
+		}
+	}
+	if sum != 6 {
+		t.Fatalf("sum of the Inputs = %d, want 6", sum)
+	}
+}
+
+func TestProcessTypedResultSendRespectsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan TypedResult[int]) // never read
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ProcessTypedResult[int](ctx, nil, 1, IntProcessor{}, out, WithNoDelay(), WithLogger(nopLogger{}))
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ProcessTypedResult blocked on an unread channel after cancel")
+	}
+}
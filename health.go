@@ -0,0 +1,40 @@
+package main
+
+// HealthStatus is a point-in-time view of a WorkerPool, for liveness and
+// readiness probes.
+type HealthStatus struct {
+	Running    bool // started and not yet stopped
+	Workers    int  // worker count set by the constructor or the latest Resize
+	QueueDepth int  // items waiting for a worker
+	Healthy    bool // Running, with QueueDepth within WithQueueHighWaterMark
+}
+
+// WithQueueHighWaterMark makes WorkerPool.Health report a pool whose queue
+// holds more than n items as unhealthy. Zero, the default, sets no mark, so
+// only a stopped pool is unhealthy, and a negative n is invalid.
+// processData ignores it.
+func WithQueueHighWaterMark(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			o.reject("WithQueueHighWaterMark", n, "negative mark")
+			return
+		}
+		o.highWater = n
+	}
+}
+
+// Health reports the pool's HealthStatus. It only reads a few counters under
+// the pool's lock, so probes may call it as often as they like, from any
+// goroutine, without slowing the workers down.
+func (p *WorkerPool) Health() HealthStatus {
+	p.mu.Lock()
+	h := HealthStatus{
+		Running:    p.ctx != nil && !p.closed,
+		Workers:    p.size,
+		QueueDepth: p.queued,
+	}
+	p.mu.Unlock()
+
+	h.Healthy = h.Running && (p.o.highWater <= 0 || h.QueueDepth <= p.o.highWater)
+	return h
+}
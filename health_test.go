@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestHealthHighWaterMark(t *testing.T) {
+	// The queue holds as many items as the pool has workers, one more than
+	// the mark.
+	const mark = 3
+	p := newStartedPool(t, mark+1, WithQueueHighWaterMark(mark))
+	p.Pause()
+
+	if h := p.Health(); !h.Healthy || !h.Running || h.Workers != mark+1 || h.QueueDepth != 0 {
+		t.Fatalf("Health() = %+v on an idle pool, want healthy with %d workers", h, mark+1)
+	}
+	for i := 1; i <= mark+1; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+		h := p.Health()
+		if h.QueueDepth != i || h.Healthy != (i <= mark) {
+			t.Errorf("Health() = %+v with %d queued, want healthy only up to %d", h, i, mark)
+		}
+	}
+
+	p.Resume()
+	p.Wait()
+	if h := p.Health(); !h.Healthy || h.QueueDepth != 0 {
+		t.Errorf("Health() = %+v once drained, want healthy", h)
+	}
+}
+
+func TestHealthStopped(t *testing.T) {
+	p, err := NewWorkerPool(2, WithNoDelay(), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	if h := p.Health(); h.Running || h.Healthy {
+		t.Errorf("Health() = %+v before Start, want neither running nor healthy", h)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if h := p.Health(); !h.Running || !h.Healthy {
+		t.Errorf("Health() = %+v after Start, want running and healthy", h)
+	}
+	p.Shutdown(true)
+	if h := p.Health(); h.Running || h.Healthy {
+		t.Errorf("Health() = %+v after Shutdown, want neither running nor healthy", h)
+	}
+}
+
+func TestHealthConcurrent(t *testing.T) {
+	p := newStartedPool(t, 2, WithQueueHighWaterMark(1))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p.Health()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				p.Submit(j)
+			}
+		}()
+	}
+	wg.Wait()
+	p.Wait()
+	if h := p.Health(); !h.Healthy {
+		t.Errorf("Health() = %+v once drained, want healthy", h)
+	}
+}
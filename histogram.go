@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Overflow is the Snapshot key of the bucket counting items slower than the
+// largest bound of a LatencyHistogram.
+const Overflow = time.Duration(math.MaxInt64)
+
+// LatencyHistogram counts processData durations in buckets with fixed upper
+// bounds. An item lands in the first bucket whose bound is at least its
+// duration. Each bucket is its own atomic counter, so any number of workers
+// may share a histogram without contending on a lock. Cancelled items are
+// counted separately and never land in a bucket.
+type LatencyHistogram struct {
+	bounds    []time.Duration // ascending
+	counts    []int64         // one per bound, plus the Overflow bucket
+	cancelled int64
+}
+
+// NewLatencyHistogram returns a histogram with the given bucket bounds, in
+// any order. Duplicate bounds are merged.
+func NewLatencyHistogram(bounds ...time.Duration) *LatencyHistogram {
+	sorted := append([]time.Duration(nil), bounds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	uniq := sorted[:0]
+	for i, b := range sorted {
+		if i == 0 || b != sorted[i-1] {
+			uniq = append(uniq, b)
+		}
+	}
+
+	return &LatencyHistogram{bounds: uniq, counts: make([]int64, len(uniq)+1)}
+}
+
+// WithLatencyHistogram makes processData record how long every item took in
+// h, measured with the configured Clock.
+func WithLatencyHistogram(h *LatencyHistogram) Option {
+	return func(o *options) {
+		o.histogram = h
+	}
+}
+
+// record counts r, which took d. It is a no-op on a nil histogram.
+func (h *LatencyHistogram) record(r Result, d time.Duration) {
+	if h == nil {
+		return
+	}
+
+	if r.Kind == KindCancelled {
+		atomic.AddInt64(&h.cancelled, 1)
+		return
+	}
+
+	i := sort.Search(len(h.bounds), func(i int) bool { return h.bounds[i] >= d })
+	atomic.AddInt64(&h.counts[i], 1)
+}
+
+// Snapshot returns the count of every bucket keyed by its bound, with items
+// slower than every bound under Overflow. The counts are read one at a time,
+// so a snapshot taken while work is in flight may not be a single instant.
+func (h *LatencyHistogram) Snapshot() map[time.Duration]int {
+	snap := make(map[time.Duration]int, len(h.counts))
+	for i, b := range h.bounds {
+		snap[b] = int(atomic.LoadInt64(&h.counts[i]))
+	}
+	snap[Overflow] = int(atomic.LoadInt64(&h.counts[len(h.bounds)]))
+	return snap
+}
+
+// Cancelled reports how many cancelled items the histogram has seen.
+func (h *LatencyHistogram) Cancelled() int {
+	return int(atomic.LoadInt64(&h.cancelled))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// classifyAfter runs Classify on c with work taking exactly d of fake time.
+func classifyAfter(t *testing.T, c *manualClock, d time.Duration, opts ...Option) Result {
+	t.Helper()
+	done := make(chan Result, 1)
+	go func() {
+		done <- Classify(context.Background(), 1, append(opts, WithClock(c), WithWorkDuration(d), WithLogger(nopLogger{}))...)
+	}()
+	waitFor(t, func() bool { return c.Waiters() == 1 })
+	c.Advance(d)
+	return <-done
+}
+
+func TestLatencyHistogramBuckets(t *testing.T) {
+	h := NewLatencyHistogram(500*time.Millisecond, 10*time.Millisecond, 100*time.Millisecond, 50*time.Millisecond, 10*time.Millisecond)
+	c := newManualClock()
+	for _, d := range []time.Duration{
+		5 * time.Millisecond,
+		10 * time.Millisecond, // a bound is inclusive
+		30 * time.Millisecond,
+		80 * time.Millisecond,
+		90 * time.Millisecond,
+		200 * time.Millisecond,
+		time.Second,
+	} {
+		classifyAfter(t, c, d, WithLatencyHistogram(h))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r := Classify(ctx, 1, WithNoDelay(), WithLatencyHistogram(h), WithLogger(nopLogger{})); r.Kind != KindCancelled {
+		t.Fatalf("Kind = %s, want cancelled", r.Kind)
+	}
+
+	want := map[time.Duration]int{
+		10 * time.Millisecond:  2,
+		50 * time.Millisecond:  1,
+		100 * time.Millisecond: 2,
+		500 * time.Millisecond: 1,
+		Overflow:               1,
+	}
+	if got := h.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot() = %v, want %v", got, want)
+	}
+	if got := h.Cancelled(); got != 1 {
+		t.Errorf("Cancelled() = %d, want 1", got)
+	}
+}
+
+func TestLatencyHistogramConcurrent(t *testing.T) {
+	h := NewLatencyHistogram(time.Hour)
+	const workers, per = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < per; j++ {
+				Classify(context.Background(), j, WithNoDelay(), WithLatencyHistogram(h), WithLogger(nopLogger{}))
+			}
+		}()
+	}
+	wg.Wait()
+	if got := h.Snapshot()[time.Hour]; got != workers*per {
+		t.Errorf("histogram counted %d items, want %d", got, workers*per)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import "fmt"
+
+// Kind classifies a Result: which type switch case handled its payload, or
+// why none did. Its values are the strings written by the JSON and CSV sinks
+// and the Prometheus kind label, and ParseKind reads them back. The zero
+// Kind is the empty string of a Result processData has not produced.
+type Kind string
+
+// The Kinds processData reports.
+const (
+	KindString    Kind = "string"    // string payload
+	KindInt       Kind = "int"       // int payload
+	KindBool      Kind = "bool"      // bool payload
+	KindFloat     Kind = "float"     // float64 payload
+	KindBytes     Kind = "bytes"     // []byte payload
+	KindNil       Kind = "nil"       // nil payload
+	KindFetched   Kind = "fetched"   // Fetcher payload fetched successfully
+	KindFailed    Kind = "failed"    // Fetcher payload whose fetch failed
+	KindCustom    Kind = "custom"    // payload handled by the HandlerRegistry
+	KindUnknown   Kind = "unknown"   // payload of an unsupported type
+	KindCancelled Kind = "cancelled" // context done before the work finished
+	KindSkipped   Kind = "skipped"   // left undone by WithBudgetCheck
+	KindRejected  Kind = "rejected"  // refused by WithMaxPayloadBytes or invalid options
+	KindFiltered  Kind = "filtered"  // dropped by WithFilter before dispatch
+	KindPanic     Kind = "panic"     // processing panicked
+)
+
+// kinds lists every Kind ParseKind accepts.
+var kinds = []Kind{
+	KindString, KindInt, KindBool, KindFloat, KindBytes, KindNil, KindFetched,
+	KindFailed, KindCustom, KindUnknown, KindCancelled, KindSkipped,
+	KindRejected, KindFiltered, KindPanic,
+}
+
+func (k Kind) String() string {
+	return string(k)
+}
+
+// ParseKind returns the Kind whose String is s, such as a kind field read
+// back from a JSONSink or CSVSink, or an error if s names no Kind.
+func ParseKind(s string) (Kind, error) {
+	for _, k := range kinds {
+		if string(k) == s {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown result kind %q", s)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseKindRoundTrip(t *testing.T) {
+	for _, k := range kinds {
+		got, err := ParseKind(k.String())
+		if err != nil || got != k {
+			t.Errorf("ParseKind(%q) = (%q, %v), want (%q, nil)", k.String(), got, err, k)
+		}
+	}
+}
+
+func TestParseKindUnknown(t *testing.T) {
+	for _, s := range []string{"", "String", "integer"} {
+		if k, err := ParseKind(s); err == nil {
+			t.Errorf("ParseKind(%q) = %q, want an error", s, k)
+		}
+	}
+}
+
+func TestClassifyKindPerInput(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		data interface{}
+		kind Kind
+	}{
+		{"string", context.Background(), "Alpha", KindString},
+		{"int", context.Background(), 42, KindInt},
+		{"float", context.Background(), 2.5, KindFloat},
+		{"bool", context.Background(), true, KindBool},
+		{"bytes", context.Background(), []byte("raw"), KindBytes},
+		{"nil", context.Background(), nil, KindNil},
+		{"unknown", context.Background(), Order{ID: 1}, KindUnknown},
+		{"cancelled", cancelled, 42, KindCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Classify(tt.ctx, tt.data, WithNoDelay(), WithLogger(nopLogger{}))
+			if r.Kind != tt.kind {
+				t.Fatalf("Classify(%v) Kind = %s, want %s", tt.data, r.Kind, tt.kind)
+			}
+		})
+	}
+}
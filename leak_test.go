@@ -0,0 +1,57 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// AssertNoGoroutineLeak runs fn and fails t if more goroutines are running
+// afterwards than before. Goroutines fn started may take a moment to exit
+// once it returns, so the count is re-checked a few times, with a short
+// settle delay in between, before a leak is reported.
+func AssertNoGoroutineLeak(t *testing.T, fn func()) {
+	t.Helper()
+	if before, after := goroutinesAround(fn); after > before {
+		buf := make([]byte, 1<<16)
+		buf = buf[:runtime.Stack(buf, true)]
+		t.Errorf("goroutine leak: %d running before, %d after\n%s", before, after, buf)
+	}
+}
+
+// goroutinesAround runs fn and returns the goroutine count before it and
+// the lowest count seen while waiting for it to settle afterwards.
+func goroutinesAround(fn func()) (before, after int) {
+	before = runtime.NumGoroutine()
+	fn()
+
+	const attempts = 20
+	for i := 0; i < attempts; i++ {
+		after = runtime.NumGoroutine()
+		if after <= before {
+			return before, after
+		}
+		runtime.Gosched()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return before, after
+}
+
+func TestGoroutinesAroundSeesLeak(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	before, after := goroutinesAround(func() { go func() { <-stop }() })
+	if after <= before {
+		t.Fatalf("before = %d, after = %d: a goroutine still blocked after fn was missed", before, after)
+	}
+}
+
+func TestGoroutinesAroundWaitsForExit(t *testing.T) {
+	before, after := goroutinesAround(func() {
+		go time.Sleep(50 * time.Millisecond)
+	})
+	if after > before {
+		t.Fatalf("before = %d, after = %d: a goroutine exiting shortly after fn was reported", before, after)
+	}
+}
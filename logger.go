@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+)
+
+// Logger receives every message produced while processing. It lets callers
+// capture output in tests or forward it to a structured logger.
+type Logger interface {
+	Logf(format string, args ...interface{})
+}
+
+// stdLogger is the default Logger, backed by the standard library log
+// package and writing plain lines to stdout.
+type stdLogger struct {
+	l *log.Logger
+}
+
+// Logf formats according to format and writes the line to the underlying
+// writer, stdout by default.
+func (s stdLogger) Logf(format string, args ...interface{}) {
+	s.l.Printf(format, args...)
+}
+
+var defaultLogger Logger = stdLogger{l: log.New(os.Stdout, "", 0)}
+
+// WithLogger routes all messages to l instead of stdout. A nil l keeps the
+// default.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithWriter makes the default Logger write its lines to w instead of
+// stdout, e.g. to capture them in a bytes.Buffer. The underlying log.Logger
+// writes each line with a single Write under its own mutex, so lines from
+// concurrent workers never interleave. The Option holds one log.Logger,
+// so reuse it for every call writing to w. A nil w keeps stdout.
+func WithWriter(w io.Writer) Option {
+	var l Logger
+	if w != nil {
+		l = stdLogger{l: log.New(w, "", 0)}
+	}
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// log returns the configured Logger, falling back to the default.
+func (o *options) log() Logger {
+	if o.logger == nil {
+		return defaultLogger
+	}
+	return o.logger
+}
+
+// nopLogger discards every message.
+type nopLogger struct{}
+
+// Logf does nothing.
+func (nopLogger) Logf(string, ...interface{}) {}
+
+// prefixLogger prefixes every line with a bracketed correlation ID.
+type prefixLogger struct {
+	id   string
+	next Logger
+}
+
+// Logf logs "[id] " followed by the formatted message.
+func (p prefixLogger) Logf(format string, args ...interface{}) {
+	p.next.Logf("[%s] "+format, append([]interface{}{p.id}, args...)...)
+}
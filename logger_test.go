@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogger is a Logger keeping every line it is given.
+type captureLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *captureLogger) Logf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+// Lines returns a copy of the lines logged so far.
+func (l *captureLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+// contains reports whether any line logged so far contains s.
+func (l *captureLogger) contains(s string) bool {
+	for _, line := range l.Lines() {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLoggerSequenceForString(t *testing.T) {
+	log := new(captureLogger)
+	processData(context.Background(), nil, "Alpha", nil, WithNoDelay(), WithLogger(log))
+
+	want := []string{"Checking string length...", "Processed String: Alpha (length 5)"}
+	if got := log.Lines(); !slices.Equal(got, want) {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+}
+
+func TestNilLoggerKeepsDefault(t *testing.T) {
+	if got := newOptions([]Option{WithLogger(nil)}).log(); got != defaultLogger {
+		t.Fatalf("WithLogger(nil) logs to %T, want the default", got)
+	}
+}
+
+func TestWithWriterCapturesBatch(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := Run(WithItems("Alpha"), WithNoDelay(), WithWriter(&buf)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{
+		"Checking string length...",
+		"Processed String: Alpha (length 5)",
+		"Summary: 1 results (string=1 int=0 bool=0 unknown=0 cancelled=0)",
+		"Program exit",
+	}
+	if got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"); !slices.Equal(got, want) {
+		t.Errorf("captured %q, want %q", got, want)
+	}
+}
+
+func TestWithWriterLinesDoNotInterleave(t *testing.T) {
+	var buf bytes.Buffer
+	items := make([]interface{}, 50)
+	for i := range items {
+		items[i] = strings.Repeat("x", 100+i)
+	}
+	if _, err := Run(WithItems(items...), WithNoDelay(), WithWriter(&buf)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if strings.HasPrefix(line, "Processed String: ") && !strings.HasSuffix(line, ")") {
+			t.Fatalf("interleaved line %q", line)
+		}
+	}
+}
+
+func TestNilWriterKeepsDefault(t *testing.T) {
+	if got := newOptions([]Option{WithWriter(nil)}).log(); got != defaultLogger {
+		t.Fatalf("WithWriter(nil) logs to %T, want the default", got)
+	}
+}
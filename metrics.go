@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// metricsPrefix namespaces every metric written by WriteMetrics.
+const metricsPrefix = "goengineer_"
+
+// labelEscaper escapes a label value for the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes s to w in the Prometheus text exposition format, with
+// no dependency on a Prometheus client:
+//
+//   - goengineer_processed_total{kind="..."}, one series per Result Kind
+//   - goengineer_completed_total, goengineer_cancelled_total,
+//     goengineer_unknown_total, goengineer_dropped_total,
+//     goengineer_filtered_total and goengineer_slow_total, matching the
+//     Stats counters
+//   - goengineer_latency_seconds, a summary of the processing time
+//
+// Each counter is read atomically, but not all at the same instant.
+func (s *Stats) WriteMetrics(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	s.mu.Lock()
+	kinds := make([]string, 0, len(s.kinds))
+	for k := range s.kinds {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	counts := make([]int64, len(kinds))
+	for i, k := range kinds {
+		counts[i] = s.kinds[k]
+	}
+	s.mu.Unlock()
+
+	fmt.Fprintf(bw, "# HELP %sprocessed_total Items processed, by Result kind.\n", metricsPrefix)
+	fmt.Fprintf(bw, "# TYPE %sprocessed_total counter\n", metricsPrefix)
+	for i, k := range kinds {
+		fmt.Fprintf(bw, "%sprocessed_total{kind=\"%s\"} %d\n", metricsPrefix, labelEscaper.Replace(k), counts[i])
+	}
+
+	counter := func(name, help string, v *int64) {
+		fmt.Fprintf(bw, "# HELP %s%s %s\n", metricsPrefix, name, help)
+		fmt.Fprintf(bw, "# TYPE %s%s counter\n", metricsPrefix, name)
+		fmt.Fprintf(bw, "%s%s %d\n", metricsPrefix, name, atomic.LoadInt64(v))
+	}
+	counter("completed_total", "Items processed by a handled type.", &s.Completed)
+	counter("cancelled_total", "Items cancelled before their work finished.", &s.Cancelled)
+	counter("unknown_total", "Unsupported, failed and panicked items.", &s.Unknown)
+	counter("dropped_total", "Results lost to the overflow policy or a cancelled send.", &s.Dropped)
+	counter("filtered_total", "Items filtered out before processing.", &s.Filtered)
+	counter("slow_total", "Items still running after the slow warning threshold.", &s.SlowCount)
+
+	sum := time.Duration(atomic.LoadInt64(&s.latencySum))
+	fmt.Fprintf(bw, "# HELP %slatency_seconds Processing time of each item.\n", metricsPrefix)
+	fmt.Fprintf(bw, "# TYPE %slatency_seconds summary\n", metricsPrefix)
+	fmt.Fprintf(bw, "%slatency_seconds_sum %g\n", metricsPrefix, sum.Seconds())
+	fmt.Fprintf(bw, "%slatency_seconds_count %d\n", metricsPrefix, atomic.LoadInt64(&s.latencyCount))
+
+	return bw.Flush()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// sampleLine matches a sample of the Prometheus text format: a metric name,
+// optional labels with escaped values, and a number.
+var sampleLine = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*"(,[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*")*\})? [-+]?[0-9.eE+-]+$`)
+
+func TestWriteMetrics(t *testing.T) {
+	stats := new(Stats)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	quiet := []Option{WithNoDelay(), WithStats(stats), WithLogger(nopLogger{})}
+	for _, item := range []interface{}{1, 2, "Alpha", Order{}} {
+		Classify(context.Background(), item, quiet...)
+	}
+	Classify(cancelled, 3, quiet...)
+
+	var buf bytes.Buffer
+	if err := stats.WriteMetrics(&buf); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+
+	samples := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		if !sampleLine.MatchString(line) {
+			t.Errorf("line %q is not a valid sample", line)
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		samples[line[:i]] = line[i+1:]
+	}
+
+	for name, want := range map[string]string{
+		`goengineer_processed_total{kind="int"}`:       "2",
+		`goengineer_processed_total{kind="string"}`:    "1",
+		`goengineer_processed_total{kind="unknown"}`:   "1",
+		`goengineer_processed_total{kind="cancelled"}`: "1",
+		"goengineer_completed_total":                   "3",
+		"goengineer_cancelled_total":                   "1",
+		"goengineer_unknown_total":                     "1",
+		"goengineer_dropped_total":                     "0",
+		"goengineer_latency_seconds_count":             "5",
+	} {
+		if got, ok := samples[name]; !ok || got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, ok := samples["goengineer_latency_seconds_sum"]; !ok {
+		t.Error("no goengineer_latency_seconds_sum sample")
+	}
+}
+
+func TestLabelEscaper(t *testing.T) {
+	if got, want := labelEscaper.Replace("a\\b\"c\nd"), `a\\b\"c\nd`; got != want {
+		t.Errorf("escaped to %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "context"
+
+// HandlerFunc processes one payload into its Result, as Classify does.
+type HandlerFunc func(ctx context.Context, data interface{}) Result
+
+// Middleware wraps a HandlerFunc with a cross-cutting concern such as
+// logging, metrics or an authorization check. It may short-circuit by
+// returning a Result without calling next.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain composes mws into one Middleware that runs them left to right: the
+// first one sees the call first and the Result last.
+func Chain(mws ...Middleware) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
+
+// WithMiddleware makes processData, and so a WorkerPool, run every item
+// through mws, composed with Chain, around the type switch. The middleware
+// sees the item's context, carrying its ID and per-item deadline. A Result
+// returned by a short-circuiting middleware is delivered, counted in the
+// Stats and handed to the sink like any other, and a panic in a middleware
+// is recovered like one in the type switch. Repeated WithMiddleware options
+// add to the chain.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware[:len(o.middleware):len(o.middleware)], mws...)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+type mwKey struct{}
+
+// tracing returns a Middleware appending name to *calls before and after
+// next, and tagging the context it passes on.
+func tracing(name string, calls *[]string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, data interface{}) Result {
+			*calls = append(*calls, name+" in")
+			r := next(context.WithValue(ctx, mwKey{}, name), data)
+			*calls = append(*calls, name+" out")
+			return r
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	var seen interface{}
+	peek := func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, data interface{}) Result {
+			seen = ctx.Value(mwKey{})
+			return next(ctx, data)
+		}
+	}
+
+	out := make(chan Result, 1)
+	processData(context.Background(), nil, 42, out, WithNoDelay(), WithLogger(nopLogger{}),
+		WithMiddleware(tracing("first", &calls), tracing("second", &calls)), WithMiddleware(peek))
+
+	if want := []string{"first in", "second in", "second out", "first out"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	if seen != "second" {
+		t.Errorf("innermost middleware saw context value %v, want the one set by second", seen)
+	}
+	if r := <-out; r.Kind != KindInt {
+		t.Errorf("Kind = %s, want int", r.Kind)
+	}
+}
+
+// deny is a Middleware short-circuiting every item with errDenied.
+var errDenied = errors.New("denied")
+
+func deny(HandlerFunc) HandlerFunc {
+	return func(_ context.Context, data interface{}) Result {
+		return Result{Input: data, Kind: KindRejected, Err: errDenied}
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	log := new(captureLogger)
+	stats := new(Stats)
+	sink := new(recordingSink)
+	out := make(chan Result, 1)
+	err := processData(context.Background(), nil, 42, out, WithNoDelay(), WithLogger(log), WithStats(stats),
+		WithSink(sink), WithMiddleware(deny))
+	if !errors.Is(err, errDenied) {
+		t.Errorf("processData = %v, want errDenied", err)
+	}
+	if r := <-out; r.Kind != KindRejected {
+		t.Errorf("Kind = %s, want the middleware's Result", r.Kind)
+	}
+	if len(log.Lines()) != 0 {
+		t.Errorf("Classify ran behind a short-circuiting middleware: logged %q", log.Lines())
+	}
+	if got := stats.counts(); got != (statsCounts{unknown: 1}) {
+		t.Errorf("Stats counts = %+v, want the rejected item counted", got)
+	}
+	if got := sink.Results(); len(got) != 1 || got[0].Kind != KindRejected {
+		t.Errorf("sink got %v, want the middleware's Result", got)
+	}
+}
+
+func TestMiddlewareShortCircuitPoolResults(t *testing.T) {
+	p := newStartedPool(t, 2, WithMiddleware(deny))
+	results := p.Results()
+	go func() {
+		for i := 0; i < 3; i++ {
+			if err := p.Submit(i); err != nil {
+				t.Errorf("Submit: %v", err)
+			}
+		}
+		if err := p.Shutdown(true); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+	}()
+
+	n := 0
+	for r := range results {
+		if r.Kind != KindRejected {
+			t.Errorf("item %v = %s, want the middleware's Result", r.Input, r.Kind)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("Results delivered %d items, want 3", n)
+	}
+}
+
+func TestMiddlewarePanicRecovered(t *testing.T) {
+	boom := func(HandlerFunc) HandlerFunc {
+		return func(context.Context, interface{}) Result { panic("boom") }
+	}
+
+	stats := new(Stats)
+	out := make(chan Result, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	err := processData(context.Background(), &wg, 42, out, WithNoDelay(), WithLogger(nopLogger{}),
+		WithStats(stats), WithMiddleware(boom))
+	wg.Wait()
+
+	if !errors.Is(err, ErrProcessingPanic) {
+		t.Errorf("processData = %v, want ErrProcessingPanic", err)
+	}
+	if r := <-out; r.Kind != KindPanic || r.Input != 42 || r.Stack == nil {
+		t.Errorf("Result = %+v, want a panic Result for 42 with its stack", r)
+	}
+	if got := stats.counts(); got != (statsCounts{unknown: 1}) {
+		t.Errorf("Stats counts = %+v, want the panicked item counted", got)
+	}
+}
+
+func TestChainEmpty(t *testing.T) {
+	core := func(_ context.Context, data interface{}) Result { return Result{Input: data} }
+	if r := Chain()(core)(context.Background(), 1); r.Input != 1 {
+		t.Errorf("Chain() changed the Result to %v", r)
+	}
+}
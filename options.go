@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultWorkDuration is how long processData simulates work for when no
+// duration has been configured, unless SetDefaultWorkDuration changed it.
+const DefaultWorkDuration = 500 * time.Millisecond
+
+// defaultWork holds the process-wide default work duration in nanoseconds.
+// It is read by every worker, so it is only accessed atomically.
+var defaultWork = int64(DefaultWorkDuration)
+
+// SetDefaultWorkDuration changes the work duration used by every call that
+// does not set one with WithWorkDuration, typically once at startup. It
+// returns an error, leaving the default unchanged, unless d is positive.
+func SetDefaultWorkDuration(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("default work duration must be positive, got %v", d)
+	}
+	atomic.StoreInt64(&defaultWork, int64(d))
+	return nil
+}
+
+// defaultRunTimeout is the deadline Run applies to the whole batch.
+const defaultRunTimeout = 200 * time.Millisecond
+
+// defaultItems are the payloads Run dispatches when none are configured.
+var defaultItems = []interface{}{"Alpha", 42, true}
+
+// options holds the settings applied to a call of processData or Run.
+type options struct {
+	workDuration time.Duration
+	noDelay      bool
+	budgetCheck  bool
+	maxPayload   int
+	requeueDepth int
+	logger       Logger
+	tracer       Tracer
+	middleware   []Middleware
+	stats        *Stats
+	histogram    *LatencyHistogram
+	types        *TypeCounter
+	events       *EventLog
+	onTransition func(itemIndex int, from, to State)
+	clock        Clock
+	countRunes   bool
+	verbose      bool
+	sink         ResultSink
+	deadLetter   chan<- Result
+	maxRetries   int
+	backoff      time.Duration
+	itemTimeout  time.Duration
+	adaptive     *adaptiveTimeout
+	ctxValues    map[interface{}]interface{}
+	secondary    context.Context
+	slowAfter    time.Duration
+	registry     *HandlerRegistry
+	fallback     func(interface{}) (interface{}, bool)
+	strictTypes  bool
+	ordered      bool
+	rateLimit    int
+	less         func(a, b interface{}) bool
+	synchronous  bool
+	filter       func(interface{}) bool
+	highWater    int
+	summary      bool
+	newIDFunc    func() string
+	inFlight     chan struct{}
+	panics       *panicCatcher
+	overflow     OverflowPolicy
+
+	// envelope, if set, is the Envelope whose Data is being processed.
+	// enqueuedAt is when the item was queued, by the Envelope or the
+	// WorkerPool, or the zero Time if unknown.
+	envelope   *Envelope
+	enqueuedAt time.Time
+
+	// collect, if set, is handed every Result, as the sink is.
+	collect func(Result)
+
+	// finish, if set, is called by processData once the item's Result has
+	// been delivered and before the WaitGroup is signalled.
+	finish func()
+
+	// Used by Run only.
+	timeout      time.Duration
+	items        []interface{}
+	itemsSet     bool
+	resultBuf    int
+	resultBufSet bool
+
+	// invalid collects the errors of Options given invalid values.
+	invalid []error
+}
+
+// Option configures processData and the helpers built on top of it.
+type Option func(*options)
+
+// newOptions applies opts in order on top of the defaults.
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ErrInvalidOption is matched by the *OptionError reported for an Option
+// given a value it cannot honour.
+var ErrInvalidOption = errors.New("invalid option")
+
+// Validate applies opts and reports every one of them given an invalid
+// value, as *OptionError values joined with errors.Join, or nil if all are
+// valid. Run, RunGroup and the WorkerPool constructors validate their
+// options the same way and refuse to start on an error. Elsewhere, as in
+// processData and the other batch helpers, every item processed under an
+// invalid Option is rejected, its Result carrying the same error.
+func Validate(opts ...Option) error {
+	return newOptions(opts).validate()
+}
+
+// validate is Validate with the options already applied.
+func (o *options) validate() error {
+	return errors.Join(o.invalid...)
+}
+
+// reject records that option was given an invalid value, which it leaves
+// unapplied.
+func (o *options) reject(option string, value interface{}, reason string) {
+	o.invalid = append(o.invalid, &OptionError{Option: option, Value: value, Reason: reason})
+}
+
+// WithWorkDuration sets how long the simulated work takes. Zero keeps the
+// default, 500ms unless changed with SetDefaultWorkDuration. A negative d is
+// invalid.
+func WithWorkDuration(d time.Duration) Option {
+	return func(o *options) {
+		if d < 0 {
+			o.reject("WithWorkDuration", d, "negative duration")
+			return
+		}
+		o.workDuration = d
+	}
+}
+
+// WithVerbose makes processData log an extra detail line for every item,
+// with its dynamic type, Kind, error and processing time. A single item can
+// be made verbose instead through WithProcessOptions.
+func WithVerbose() Option {
+	return func(o *options) {
+		o.verbose = true
+	}
+}
+
+// override returns a copy of o with the non-zero fields of po applied. o is
+// shared by every item of a call, so it is never modified in place.
+func (o *options) override(po ProcessOptions) *options {
+	c := *o
+	if po.Verbose {
+		c.verbose = true
+	}
+	if po.WorkDuration > 0 {
+		c.workDuration = po.WorkDuration
+	}
+	return &c
+}
+
+// WithCountRunes makes processData report the length of string payloads in
+// runes rather than bytes.
+func WithCountRunes() Option {
+	return func(o *options) {
+		o.countRunes = true
+	}
+}
+
+// stringLength returns the length reported for s: its byte length, or its
+// rune count when WithCountRunes is set.
+func (o *options) stringLength(s string) int {
+	if o.countRunes {
+		return utf8.RuneCountInString(s)
+	}
+	return len(s)
+}
+
+// work returns the effective simulated work duration, zero under
+// WithNoDelay.
+func (o *options) work() time.Duration {
+	if o.noDelay {
+		return 0
+	}
+	if o.workDuration <= 0 {
+		return time.Duration(atomic.LoadInt64(&defaultWork))
+	}
+	return o.workDuration
+}
+
+// WithNoDelay skips the simulated work entirely, so processData runs the
+// type switch as soon as it has checked the context. It overrides
+// WithWorkDuration.
+func WithNoDelay() Option {
+	return func(o *options) {
+		o.noDelay = true
+	}
+}
+
+// WithStrictTypes treats an unsupported payload as a programming error:
+// instead of reporting Kind "unknown", processData panics with a
+// *StrictTypeError naming the payload's type. The panic is recovered into a
+// Kind "panic" Result like any other. Strict mode is off by default.
+func WithStrictTypes() Option {
+	return func(o *options) {
+		o.strictTypes = true
+	}
+}
+
+// WithBudgetCheck makes processData skip an item, with Kind "skipped" and
+// ErrInsufficientBudget, when the time left before its context's deadline is
+// shorter than the work duration, rather than start work that is bound to be
+// cancelled. Items whose context has no deadline always proceed. It is off
+// by default, so a deadline shorter than the work still cancels the item.
+func WithBudgetCheck() Option {
+	return func(o *options) {
+		o.budgetCheck = true
+	}
+}
+
+// budgetShort reports whether WithBudgetCheck should skip the item under
+// ctx, and how much time it had left.
+func (o *options) budgetShort(ctx context.Context) (time.Duration, bool) {
+	if !o.budgetCheck {
+		return 0, false
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	left := deadline.Sub(o.clk().Now())
+	return left, left < o.work()
+}
+
+// WithMaxPayloadBytes makes processData reject, with Kind "rejected" and a
+// *PayloadTooLargeError, any string or []byte payload longer than n bytes,
+// before doing any work on it. Zero, the default, sets no limit and a
+// negative n is invalid.
+func WithMaxPayloadBytes(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			o.reject("WithMaxPayloadBytes", n, "negative size")
+			return
+		}
+		o.maxPayload = n
+	}
+}
+
+// oversized returns the PayloadTooLargeError rejecting data under
+// WithMaxPayloadBytes, or nil if data may be processed. Only its length is
+// looked at, so the payload is never copied.
+func (o *options) oversized(data interface{}) *PayloadTooLargeError {
+	if o.maxPayload <= 0 {
+		return nil
+	}
+
+	var size int
+	switch v := data.(type) {
+	case string:
+		size = len(v)
+	case []byte:
+		size = len(v)
+	default:
+		return nil
+	}
+	if size <= o.maxPayload {
+		return nil
+	}
+	return &PayloadTooLargeError{Size: size, Max: o.maxPayload}
+}
+
+// WithTimeout sets the deadline Run applies to the whole batch. Zero keeps
+// the 200ms default. A negative d is invalid.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d < 0 {
+			o.reject("WithTimeout", d, "negative duration")
+			return
+		}
+		o.timeout = d
+	}
+}
+
+// WithItemTimeout gives every item its own deadline of d, on top of any
+// deadline carried by the context it is processed under. Zero sets none and
+// a negative d is invalid.
+func WithItemTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d < 0 {
+			o.reject("WithItemTimeout", d, "negative duration")
+			return
+		}
+		o.itemTimeout = d
+	}
+}
+
+// WithMaxInFlight caps at n the number of items processed at once by every
+// call sharing the option, whichever goroutines run them, independently of
+// the number of workers. Items over the cap wait for a slot, and are
+// reported as cancelled if their context is done first. Reuse the same
+// Option value for all the calls the cap applies to; an n of zero means no
+// cap and a negative n is invalid.
+func WithMaxInFlight(n int) Option {
+	var sem chan struct{}
+	if n > 0 {
+		sem = make(chan struct{}, n)
+	}
+	return func(o *options) {
+		if n < 0 {
+			o.reject("WithMaxInFlight", n, "negative cap")
+			return
+		}
+		o.inFlight = sem
+	}
+}
+
+// acquire takes a WithMaxInFlight slot, reporting false if ctx is done
+// first. Without a cap it always succeeds.
+func (o *options) acquire(ctx context.Context) bool {
+	if o.inFlight == nil {
+		return true
+	}
+
+	select {
+	case o.inFlight <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release gives back the slot taken by acquire.
+func (o *options) release() {
+	if o.inFlight != nil {
+		<-o.inFlight
+	}
+}
+
+// withCollector makes classify hand every Result to fn.
+func withCollector(fn func(Result)) Option {
+	return func(o *options) {
+		o.collect = fn
+	}
+}
+
+// WithItems sets the payloads Run dispatches instead of the default
+// "Alpha", 42 and true. Run launches exactly one goroutine per item, so
+// WithItems() with no arguments dispatches nothing.
+func WithItems(items ...interface{}) Option {
+	return func(o *options) {
+		o.items = items
+		o.itemsSet = true
+	}
+}
+
+// WithResultBuffer sets the capacity of the results channel Run's workers
+// deliver on. Zero makes it unbuffered, so each worker waits for the
+// collector to take its Result. Without the option the channel has room for
+// every item. A negative n is invalid.
+func WithResultBuffer(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			o.reject("WithResultBuffer", n, "negative capacity")
+			return
+		}
+		o.resultBuf = n
+		o.resultBufSet = true
+	}
+}
+
+// resultBuffer returns the capacity of Run's results channel for a batch of
+// n items.
+func (o *options) resultBuffer(n int) int {
+	if !o.resultBufSet {
+		return n
+	}
+	return o.resultBuf
+}
+
+// runTimeout returns the effective batch deadline for Run.
+func (o *options) runTimeout() time.Duration {
+	if o.timeout <= 0 {
+		return defaultRunTimeout
+	}
+	return o.timeout
+}
+
+// runItems returns the payloads Run dispatches.
+func (o *options) runItems() []interface{} {
+	if !o.itemsSet {
+		return defaultItems
+	}
+	return o.items
+}
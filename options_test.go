@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// optionErrors returns the Option names of the *OptionError values joined
+// in err.
+func optionErrors(t *testing.T, err error) map[string]bool {
+	t.Helper()
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("err = %v, want errors joined with errors.Join", err)
+	}
+	names := make(map[string]bool)
+	for _, e := range joined.Unwrap() {
+		var oe *OptionError
+		if !errors.As(e, &oe) {
+			t.Fatalf("joined error %v is not an *OptionError", e)
+		}
+		names[oe.Option] = true
+	}
+	return names
+}
+
+func TestValidateReportsEveryInvalidOption(t *testing.T) {
+	err := Validate(
+		WithRateLimit(0),
+		WithResultBuffer(-1),
+		WithWorkDuration(-time.Second),
+		WithMaxPayloadBytes(-1),
+		WithSlowWarning(-time.Second),
+		WithMaxInFlight(-1),
+		WithMaxRequeueDepth(-1),
+		WithQueueHighWaterMark(-1),
+	)
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("err = %v, want ErrInvalidOption", err)
+	}
+
+	names := optionErrors(t, err)
+	for _, want := range []string{
+		"WithRateLimit", "WithResultBuffer", "WithWorkDuration",
+		"WithMaxPayloadBytes", "WithSlowWarning", "WithMaxInFlight",
+		"WithMaxRequeueDepth", "WithQueueHighWaterMark",
+	} {
+		if !names[want] {
+			t.Errorf("no error for %s in %v", want, err)
+		}
+	}
+}
+
+func TestValidateAcceptsZero(t *testing.T) {
+	err := Validate(
+		WithMaxPayloadBytes(0),
+		WithSlowWarning(0),
+		WithMaxInFlight(0),
+		WithMaxRequeueDepth(0),
+		WithQueueHighWaterMark(0),
+	)
+	if err != nil {
+		t.Fatalf("Validate = %v, want nil", err)
+	}
+}
+
+func TestNewWorkerPoolRejectsSize(t *testing.T) {
+	p, err := NewWorkerPool(0, WithResultBuffer(-1))
+	if p != nil {
+		t.Fatal("NewWorkerPool returned a pool for size 0")
+	}
+	names := optionErrors(t, err)
+	if !names["NewWorkerPool"] || !names["WithResultBuffer"] {
+		t.Fatalf("err = %v, want errors for the size and WithResultBuffer", err)
+	}
+}
+
+func TestBatchHelpersValidate(t *testing.T) {
+	ctx := context.Background()
+	items := []interface{}{1, "a"}
+	bad := WithMaxInFlight(-1)
+
+	if _, err := Run(WithItems(items...), bad); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("Run: err = %v", err)
+	}
+	if err := RunGroup(ctx, items, bad); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("RunGroup: err = %v", err)
+	}
+
+	// The other helpers reject every item instead, as processData does.
+	rejected := func(name string, results []Result) {
+		t.Helper()
+		if len(results) == 0 {
+			t.Errorf("%s: no Results", name)
+		}
+		for _, r := range results {
+			if r.Kind != KindRejected || !errors.Is(r.Err, ErrInvalidOption) {
+				t.Errorf("%s: item %v = (%s, %v), want rejected with ErrInvalidOption", name, r.Input, r.Kind, r.Err)
+			}
+		}
+	}
+	r, _ := ProcessAllFailFast(ctx, items, bad)
+	rejected("ProcessAllFailFast", r)
+	collect, _ := RunCancellable(items, bad)
+	rejected("RunCancellable", collect())
+	rejected("ProcessBatch", ProcessBatch(ctx, items, bad))
+	var mapped []Result
+	for _, r := range ProcessMap(ctx, map[string]interface{}{"a": 1}, bad) {
+		mapped = append(mapped, r)
+	}
+	rejected("ProcessMap", mapped)
+	rejected("Classify", []Result{Classify(ctx, 1, bad)})
+
+	sink := new(recordingSink)
+	Dispatch(ctx, items, bad, WithSink(sink)).Wait()
+	rejected("Dispatch", sink.Results())
+}
+
+func TestWithWorkDurationRunsBeforeDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	r := Classify(ctx, 42, WithWorkDuration(50*time.Millisecond), WithLogger(nopLogger{}))
+	if r.Kind != KindInt || r.Output != "Processed Int: 42" {
+		t.Fatalf("Classify = (%s, %q), want the int branch", r.Kind, r.Output)
+	}
+}
+
+func TestWithWorkDurationZeroKeepsDefault(t *testing.T) {
+	o := newOptions([]Option{WithWorkDuration(0)})
+	if got := o.work(); got != DefaultWorkDuration {
+		t.Fatalf("work() = %v, want %v", got, DefaultWorkDuration)
+	}
+	o = newOptions([]Option{WithWorkDuration(50 * time.Millisecond)})
+	if got := o.work(); got != 50*time.Millisecond {
+		t.Fatalf("work() = %v, want 50ms", got)
+	}
+}
+
+func TestWithItemTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	results := ProcessBatch(ctx, []interface{}{1, 2, 3}, WithWorkDuration(time.Hour), WithItemTimeout(10*time.Millisecond))
+	for _, r := range results {
+		if r.Kind != KindCancelled || !errors.Is(r.CancelCause, context.DeadlineExceeded) {
+			t.Errorf("%v: Kind %s, cause %v, want its own timeout", r.Input, r.Kind, r.CancelCause)
+		}
+	}
+	if ctx.Err() != nil {
+		t.Fatal("the parent context expired, so the items did not time out on their own")
+	}
+}
+
+func TestWithItemTimeoutParentCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	r := Classify(ctx, 1, WithWorkDuration(time.Hour), WithItemTimeout(time.Hour), WithLogger(nopLogger{}))
+	if r.Kind != KindCancelled || !errors.Is(r.CancelCause, context.Canceled) {
+		t.Fatalf("Kind %s, cause %v, want cancelled by the parent", r.Kind, r.CancelCause)
+	}
+}
+
+func TestWithMaxInFlightCapsConcurrency(t *testing.T) {
+	g := new(gauge)
+	p := newStartedPool(t, 8, WithMaxInFlight(2))
+	for i := 0; i < 32; i++ {
+		if err := p.Submit(trackedFetcher{g, 5 * time.Millisecond}); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	p.Wait()
+	if got := g.Max(); got != 2 {
+		t.Errorf("%d items ran at once, want at most 2 and the cap reached", got)
+	}
+}
+
+func TestWithMaxInFlightAcquireRespectsCancel(t *testing.T) {
+	cap1 := WithMaxInFlight(1)
+	held, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	go Classify(context.Background(), heldFetcher{held, release}, WithNoDelay(), cap1, WithLogger(nopLogger{}))
+	<-held
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	r := Classify(ctx, 1, WithNoDelay(), cap1, WithLogger(nopLogger{}))
+	if r.Kind != KindCancelled || !errors.Is(r.Err, context.DeadlineExceeded) {
+		t.Errorf("item waiting for a slot = (%s, %v), want cancelled by its deadline", r.Kind, r.Err)
+	}
+}
+
+func TestWithNoDelayRunsImmediately(t *testing.T) {
+	start := time.Now()
+	// WithNoDelay wins over a work duration that would outlast the test.
+	r := Classify(context.Background(), 42, WithWorkDuration(time.Hour), WithNoDelay(), WithLogger(nopLogger{}))
+	if r.Kind != KindInt {
+		t.Fatalf("Kind = %s, want int", r.Kind)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Classify took %v with WithNoDelay", elapsed)
+	}
+}
+
+func BenchmarkWorkDelay(b *testing.B) {
+	ctx := context.Background()
+	for _, bm := range []struct {
+		name string
+		opts []Option
+	}{
+		{"NoDelay", []Option{WithNoDelay(), WithLogger(nopLogger{})}},
+		{"DefaultDelay", []Option{WithLogger(nopLogger{})}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				Classify(ctx, 42, bm.opts...)
+			}
+		})
+	}
+}
+
+func TestWithResultBufferRunCollectsEverything(t *testing.T) {
+	items := []interface{}{"Alpha", 1, true, 2.5, nil}
+	for _, n := range []int{0, 1, 100} {
+		results, err := Run(WithItems(items...), WithResultBuffer(n), WithNoDelay(), WithLogger(nopLogger{}))
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if len(results) != len(items) {
+			t.Errorf("WithResultBuffer(%d): collected %d Results, want %d", n, len(results), len(items))
+		}
+	}
+}
+
+// TestWithResultBufferStalls measures, on a fake clock, how long workers
+// stall sending their Results to a consumer that reads one Result per 10ms,
+// on a channel sized as Run sizes it.
+func TestWithResultBufferStalls(t *testing.T) {
+	const items = 10
+	const perRead = 10 * time.Millisecond
+	for _, buffer := range []int{0, 100} {
+		c := newManualClock()
+		o := newOptions([]Option{WithResultBuffer(buffer)})
+		results := make(chan Result, o.resultBuffer(items))
+
+		stalls := make(chan time.Duration, items)
+		var started sync.WaitGroup
+		started.Add(items)
+		for i := 0; i < items; i++ {
+			go func() {
+				begin := c.Now()
+				started.Done()
+				processData(context.Background(), nil, i, results, WithClock(c), WithNoDelay(), WithLogger(nopLogger{}))
+				stalls <- c.Now().Sub(begin)
+			}()
+		}
+		// Every worker reads its start time before the clock first moves,
+		// and with room for every Result they all finish without it moving.
+		started.Wait()
+		if buffer >= items {
+			waitFor(t, func() bool { return len(stalls) == items })
+		}
+
+		for i := 0; i < items; i++ {
+			c.Advance(perRead)
+			<-results
+		}
+
+		var total time.Duration
+		for i := 0; i < items; i++ {
+			d := <-stalls
+			if buffer == 0 && d < perRead {
+				t.Errorf("buffer 0: a worker stalled %v, want at least one read interval", d)
+			}
+			total += d
+		}
+		// Unbuffered, the k-th Result cannot be sent before the k-th read.
+		if buffer == 0 && total < perRead*items*(items+1)/2 {
+			t.Errorf("buffer 0: workers stalled %v in total, want at least %v", total, perRead*items*(items+1)/2)
+		}
+		if buffer == 100 && total != 0 {
+			t.Errorf("buffer 100: workers stalled %v in total, want none", total)
+		}
+	}
+}
+
+func TestSetDefaultWorkDuration(t *testing.T) {
+	if err := SetDefaultWorkDuration(2 * time.Second); err != nil {
+		t.Fatalf("SetDefaultWorkDuration: %v", err)
+	}
+	t.Cleanup(func() { SetDefaultWorkDuration(DefaultWorkDuration) })
+
+	c := newManualClock()
+	done := make(chan Result, 1)
+	go func() {
+		done <- Classify(context.Background(), 42, WithClock(c), WithLogger(nopLogger{}))
+	}()
+	waitFor(t, func() bool { return c.Waiters() == 1 })
+
+	c.Advance(2*time.Second - time.Nanosecond)
+	select {
+	case <-done:
+		t.Fatal("work finished before the new default duration")
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.Advance(time.Nanosecond)
+	if r := <-done; r.Kind != KindInt || r.ProcessTime != 2*time.Second {
+		t.Errorf("Result = %s after %v, want the int branch after 2s", r.Kind, r.ProcessTime)
+	}
+}
+
+func TestSetDefaultWorkDurationRejectsNonPositive(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		if err := SetDefaultWorkDuration(d); err == nil {
+			t.Errorf("SetDefaultWorkDuration(%v) accepted", d)
+		}
+	}
+	if got := newOptions(nil).work(); got != DefaultWorkDuration {
+		t.Errorf("default changed to %v by a rejected value", got)
+	}
+}
+
+func TestWithBudgetCheckSkipsDoomedWork(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	r := Classify(ctx, 42, WithWorkDuration(time.Second), WithBudgetCheck(), WithLogger(nopLogger{}))
+	if r.Kind != KindSkipped || !errors.Is(r.Err, ErrInsufficientBudget) {
+		t.Errorf("Result = (%s, %v), want skipped for lack of budget", r.Kind, r.Err)
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("skipping took %v, want no wait", elapsed)
+	}
+}
+
+func TestWithBudgetCheckAmpleBudget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if r := Classify(ctx, 42, WithWorkDuration(time.Millisecond), WithBudgetCheck(), WithLogger(nopLogger{})); r.Kind != KindInt {
+		t.Errorf("Kind = %s, want int", r.Kind)
+	}
+
+	// Without a deadline there is no budget to run short of.
+	if r := Classify(context.Background(), 42, WithWorkDuration(time.Millisecond), WithBudgetCheck(), WithLogger(nopLogger{})); r.Kind != KindInt {
+		t.Errorf("Kind = %s without a deadline, want int", r.Kind)
+	}
+}
+
+func TestWithoutBudgetCheckWaitsForDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if r := Classify(ctx, 42, WithWorkDuration(time.Second), WithLogger(nopLogger{})); r.Kind != KindCancelled {
+		t.Errorf("Kind = %s, want cancelled at the deadline when the check is off", r.Kind)
+	}
+}
+
+func TestWithMaxPayloadBytes(t *testing.T) {
+	quiet := []Option{WithNoDelay(), WithLogger(nopLogger{}), WithMaxPayloadBytes(4)}
+	tests := []struct {
+		name string
+		data interface{}
+		size int // 0 for a payload under the limit
+		kind Kind
+	}{
+		{"long string", "Alpha", 5, KindRejected},
+		{"long bytes", []byte("abcdefgh"), 8, KindRejected},
+		{"short string", "Beta", 0, KindString},
+		{"short bytes", []byte("ab"), 0, KindBytes},
+		{"int", 123456, 0, KindInt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Classify(context.Background(), tt.data, quiet...)
+			if r.Kind != tt.kind {
+				t.Fatalf("Kind = %s, want %s", r.Kind, tt.kind)
+			}
+			if tt.size == 0 {
+				if r.Err != nil {
+					t.Fatalf("Err = %v, want nil", r.Err)
+				}
+				return
+			}
+			var perr *PayloadTooLargeError
+			if !errors.Is(r.Err, ErrPayloadTooLarge) || !errors.As(r.Err, &perr) {
+				t.Fatalf("Err = %v, want a *PayloadTooLargeError", r.Err)
+			}
+			if perr.Size != tt.size || perr.Max != 4 {
+				t.Errorf("PayloadTooLargeError = %+v, want Size %d, Max 4", perr, tt.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// WithOrderedOutput makes Run and Dispatch print each item's lines in
+// submission order instead of as they happen. Lines are buffered per item
+// and an item's buffer is flushed as soon as it and every item before it
+// have finished, so cancelled items release their successors just like
+// processed ones and the output never stalls. Streaming output in completion
+// order remains the default.
+func WithOrderedOutput() Option {
+	return func(o *options) {
+		o.ordered = true
+	}
+}
+
+// orderedOutput buffers the log lines of a batch and writes them to the
+// underlying Logger in item order.
+type orderedOutput struct {
+	log Logger
+
+	mu    sync.Mutex
+	lines [][]string
+	done  []bool
+	next  int // index of the first item not yet flushed
+}
+
+func newOrderedOutput(log Logger, n int) *orderedOutput {
+	return &orderedOutput{
+		log:   log,
+		lines: make([][]string, n),
+		done:  make([]bool, n),
+	}
+}
+
+// option returns the Option routing item i's output into the buffer.
+func (b *orderedOutput) option(i int) Option {
+	return func(o *options) {
+		o.logger = itemLogger{b: b, i: i}
+		o.finish = func() { b.finish(i) }
+	}
+}
+
+// finish marks item i as done and flushes every buffered item that is now
+// at the head of the order.
+func (b *orderedOutput) finish(i int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.done[i] = true
+	for b.next < len(b.done) && b.done[b.next] {
+		for _, line := range b.lines[b.next] {
+			b.log.Logf("%s", line)
+		}
+		b.lines[b.next] = nil
+		b.next++
+	}
+}
+
+// itemLogger is the Logger handed to a single item in ordered mode.
+type itemLogger struct {
+	b *orderedOutput
+	i int
+}
+
+// Logf appends the formatted line to the item's buffer.
+func (l itemLogger) Logf(format string, args ...interface{}) {
+	l.b.mu.Lock()
+	defer l.b.mu.Unlock()
+	l.b.lines[l.i] = append(l.b.lines[l.i], fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sleepFetcher is a payload whose Fetch takes d, or until its context is
+// done, and returns name.
+type sleepFetcher struct {
+	name string
+	d    time.Duration
+}
+
+func (f sleepFetcher) Fetch(ctx context.Context) (string, error) {
+	select {
+	case <-time.After(f.d):
+		return f.name, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func TestOrderedOutput(t *testing.T) {
+	log := new(captureLogger)
+	// Later items finish first; the last one is still running at the
+	// deadline and fails instead.
+	_, err := Run(
+		WithItems(
+			sleepFetcher{"item 0", 30 * time.Millisecond},
+			sleepFetcher{"item 1", 20 * time.Millisecond},
+			sleepFetcher{"item 2", 10 * time.Millisecond},
+			sleepFetcher{"item 3", time.Hour},
+		),
+		WithNoDelay(), WithTimeout(100*time.Millisecond), WithOrderedOutput(), WithLogger(log),
+	)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var order []string
+	for _, line := range log.Lines() {
+		switch {
+		case strings.HasPrefix(line, "Processed Fetch: "):
+			order = append(order, strings.TrimPrefix(line, "Processed Fetch: "))
+		case strings.HasPrefix(line, "Fetch failed"):
+			order = append(order, "failed")
+		}
+	}
+	want := "item 0,item 1,item 2,failed"
+	if got := strings.Join(order, ","); got != want {
+		t.Fatalf("output order %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what processData does with a Result when the
+// results channel has no room for it.
+type OverflowPolicy int
+
+const (
+	// Block waits for room, giving up only when the item's context is done.
+	Block OverflowPolicy = iota
+	// DropNewest discards the Result that did not fit.
+	DropNewest
+	// DropOldest keeps the Result that did not fit in a small ring buffer,
+	// which is forwarded to the channel as room appears, discarding the
+	// oldest buffered Result once the ring is full.
+	DropOldest
+)
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "Block"
+	case DropNewest:
+		return "DropNewest"
+	case DropOldest:
+		return "DropOldest"
+	}
+	return "OverflowPolicy(?)"
+}
+
+// WithOverflowPolicy sets how processData handles a full results channel.
+// Every Result lost to the policy, or to a cancelled context while blocked,
+// is counted in Stats.Dropped. The default is Block. A value other than
+// Block, DropNewest and DropOldest is invalid.
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return func(o *options) {
+		if p < Block || p > DropOldest {
+			o.reject("WithOverflowPolicy", p, "unknown policy")
+			return
+		}
+		o.overflow = p
+	}
+}
+
+// send delivers r on results according to the overflow policy, without ever
+// blocking a cancelled worker. A nil channel means the caller is not
+// interested in results.
+func (o *options) send(ctx context.Context, results chan<- Result, r Result) {
+	if results == nil {
+		return
+	}
+
+	if o.overflow == DropOldest {
+		sendDropOldest(ctx, results, r, o.stats)
+		return
+	}
+
+	// Prefer delivering the Result when there is room, even if ctx is
+	// already done; a select with both cases ready would pick at random.
+	select {
+	case results <- r:
+		return
+	default:
+	}
+
+	if o.overflow == DropNewest {
+		o.stats.drop(1)
+		return
+	}
+
+	select {
+	case results <- r:
+	case <-ctx.Done():
+		o.stats.drop(1)
+	}
+}
+
+// resultRing is the DropOldest backlog of one results channel. It holds up
+// to cap(ch) Results (at least one) waiting for room in ch.
+type resultRing struct {
+	ch    chan<- Result
+	stats *Stats
+	buf   []ringEntry
+	head  int
+	n     int
+}
+
+// ringEntry is one buffered Result, with the context of the item it belongs
+// to and the channel closed once it has been delivered or dropped.
+type ringEntry struct {
+	ctx  context.Context
+	r    Result
+	done chan struct{}
+}
+
+// rings maps each results channel with a DropOldest backlog to its ring.
+// A ring only exists while it is non-empty, so channels with room never pay
+// for one and no forwarding goroutine outlives its backlog.
+var rings = struct {
+	sync.Mutex
+	m map[chan<- Result]*resultRing
+}{m: make(map[chan<- Result]*resultRing)}
+
+// sendDropOldest delivers r directly when ch has room and no backlog, and
+// otherwise appends it to ch's ring, starting the forwarder if needed. It
+// returns only once r has been delivered or dropped, so the worker never
+// signals its WaitGroup while its Result may still be sent, and a caller
+// closing ch after Wait cannot race the forwarder.
+func sendDropOldest(ctx context.Context, ch chan<- Result, r Result, stats *Stats) {
+	rings.Lock()
+	rg, ok := rings.m[ch]
+	if !ok {
+		select {
+		case ch <- r:
+			rings.Unlock()
+			return
+		default:
+		}
+
+		rg = &resultRing{ch: ch, stats: stats, buf: make([]ringEntry, max(cap(ch), 1))}
+		rings.m[ch] = rg
+		go rg.forward()
+	}
+	done := make(chan struct{})
+	rg.push(ringEntry{ctx: ctx, r: r, done: done})
+	rings.Unlock()
+
+	<-done
+}
+
+// push appends e, evicting the oldest buffered Result if the ring is full.
+// The caller holds rings.
+func (rg *resultRing) push(e ringEntry) {
+	if rg.n == len(rg.buf) {
+		close(rg.buf[rg.head].done)
+		rg.buf[rg.head] = ringEntry{}
+		rg.head = (rg.head + 1) % len(rg.buf)
+		rg.n--
+		rg.stats.drop(1)
+	}
+	rg.buf[(rg.head+rg.n)%len(rg.buf)] = e
+	rg.n++
+}
+
+// forward moves buffered Results into the channel, oldest first, until the
+// ring is empty. A Result whose item's context is done before there is room
+// for it is dropped.
+func (rg *resultRing) forward() {
+	for {
+		rings.Lock()
+		if rg.n == 0 {
+			delete(rings.m, rg.ch)
+			rings.Unlock()
+			return
+		}
+		e := rg.buf[rg.head]
+		rg.buf[rg.head] = ringEntry{}
+		rg.head = (rg.head + 1) % len(rg.buf)
+		rg.n--
+		rings.Unlock()
+
+		select {
+		case rg.ch <- e.r:
+		case <-e.ctx.Done():
+			rg.stats.drop(1)
+		}
+		close(e.done)
+	}
+}
+
+// drop counts n Results lost to the overflow policy. It is a no-op on a nil
+// Stats.
+func (s *Stats) drop(n int64) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.Dropped, n)
+}
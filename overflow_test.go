@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunDropOldestSaturated(t *testing.T) {
+	items := make([]interface{}, 50)
+	for i := range items {
+		items[i] = i
+	}
+
+	stats := new(Stats)
+	results, err := Run(
+		WithOverflowPolicy(DropOldest),
+		WithResultBuffer(1),
+		WithItems(items...),
+		WithNoDelay(),
+		WithStats(stats),
+		WithLogger(nopLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := int64(len(results)) + stats.Dropped; got != int64(len(items)) {
+		t.Errorf("delivered %d + dropped %d = %d, want %d", len(results), stats.Dropped, got, len(items))
+	}
+}
+
+func TestDropOldestKeepsNewest(t *testing.T) {
+	ch := make(chan Result, 2)
+	ch <- Result{Input: "full"}
+	ch <- Result{Input: "full"}
+
+	stats := new(Stats)
+	o := newOptions([]Option{WithOverflowPolicy(DropOldest), WithStats(stats)})
+
+	// Each send blocks until its Result is delivered or evicted, so send
+	// from goroutines, one at a time. The forwarder takes the first Result
+	// and then blocks on the full channel; later ones wait in the ring of two,
+	// evicting the oldest.
+	const n = 5
+	done := make(chan interface{}, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			o.send(context.Background(), ch, Result{Input: i})
+			done <- i
+		}(i)
+		waitFor(t, func() bool {
+			rings.Lock()
+			defer rings.Unlock()
+			rg := rings.m[ch]
+			return rg != nil && rg.n+int(atomic.LoadInt64(&stats.Dropped)) == i
+		})
+	}
+
+	// 1 and 2 were evicted by 3 and 4.
+	for _, want := range []interface{}{1, 2} {
+		if got := <-done; got != want {
+			t.Fatalf("send of %v returned first, want %v", got, want)
+		}
+	}
+	if stats.Dropped != 2 {
+		t.Fatalf("Dropped = %d, want 2", stats.Dropped)
+	}
+
+	var got []interface{}
+	for len(got) < 5 {
+		got = append(got, (<-ch).Input)
+	}
+	want := []interface{}{"full", "full", 0, 3, 4}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("received %v, want %v", got, want)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+}
+
+func TestDropOldestCancelledItemDoesNotBlock(t *testing.T) {
+	ch := make(chan Result) // never read
+	ctx, cancel := context.WithCancel(context.Background())
+	o := newOptions([]Option{WithOverflowPolicy(DropOldest)})
+
+	returned := make(chan struct{})
+	go func() {
+		o.send(ctx, ch, Result{Input: 1})
+		close(returned)
+	}()
+	cancel()
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("send still blocked after its context was cancelled")
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDropNewestSaturated(t *testing.T) {
+	stats := new(Stats)
+	results := make(chan Result, 1)
+	for i := 0; i < 5; i++ {
+		processData(context.Background(), nil, i, results, WithNoDelay(), WithLogger(nopLogger{}),
+			WithOverflowPolicy(DropNewest), WithStats(stats))
+	}
+	if r := <-results; r.Input != 0 {
+		t.Fatalf("kept %v, want the first Result", r.Input)
+	}
+	if stats.Dropped != 4 {
+		t.Fatalf("Dropped = %d, want 4", stats.Dropped)
+	}
+}
+
+func TestBlockSaturated(t *testing.T) {
+	stats := new(Stats)
+	results := make(chan Result, 1)
+	results <- Result{Input: "full"}
+
+	// Block waits for room until the item's context gives up.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		processData(ctx, nil, 1, results, WithNoDelay(), WithLogger(nopLogger{}), WithStats(stats))
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Block returned while the context was live and the channel full")
+	case <-time.After(5 * time.Millisecond):
+	}
+	<-done
+	if stats.Dropped != 1 || len(results) != 1 {
+		t.Fatalf("Dropped = %d with %d buffered, want the blocked Result dropped", stats.Dropped, len(results))
+	}
+}
+
+func TestOverflowPolicyInvalid(t *testing.T) {
+	if err := Validate(WithOverflowPolicy(OverflowPolicy(7))); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("Validate = %v, want ErrInvalidOption", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "sync"
+
+// panicCatcher holds the first panic recovered by processData for
+// WithPanicPropagation.
+type panicCatcher struct {
+	mu    sync.Mutex
+	first *PanicError
+}
+
+// WithPanicPropagation makes the batch helpers re-raise a worker panic on
+// the calling goroutine instead of only recording it. Every panic is still
+// recovered and reported in its Result, but once the workers are done
+// Run, RunGroup, ProcessAllFailFast, ProcessBatch, ProcessMap, the results
+// func of RunCancellable and WorkerPool.Wait panic with a *PanicError for the
+// first one, carrying the original value and the worker's stack. Later
+// panics of the same batch are only recorded. The Option keeps its state
+// between calls, so share it only between batches waited on one at a time.
+func WithPanicPropagation() Option {
+	c := new(panicCatcher)
+	return func(o *options) {
+		o.panics = c
+	}
+}
+
+// catch records p unless an earlier panic is already waiting to be
+// re-raised. It is a no-op on a nil panicCatcher.
+func (c *panicCatcher) catch(p *PanicError) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.first == nil {
+		c.first = p
+	}
+}
+
+// repanic re-raises the first panic recorded since the previous call, if
+// WithPanicPropagation is set. The caller must only call it once the
+// workers it waited on are done.
+func (o *options) repanic() {
+	if o.panics == nil {
+		return
+	}
+
+	o.panics.mu.Lock()
+	p := o.panics.first
+	o.panics.first = nil
+	o.panics.mu.Unlock()
+
+	if p != nil {
+		panic(p)
+	}
+}
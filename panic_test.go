@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// recovered calls fn and returns what it panicked with, nil if it did not.
+func recovered(fn func()) (v interface{}) {
+	defer func() { v = recover() }()
+	fn()
+	return nil
+}
+
+func TestPanicPropagationRun(t *testing.T) {
+	propagate := WithPanicPropagation()
+	var results []Result
+	v := recovered(func() {
+		results, _ = Run(WithItems(panicFetcher{"first"}, 1, panicFetcher{"second"}), propagate,
+			WithSynchronous(), WithNoDelay(), WithLogger(nopLogger{}))
+	})
+
+	perr, ok := v.(*PanicError)
+	if !ok {
+		t.Fatalf("Run panicked with %v, want a *PanicError", v)
+	}
+	if perr.Value != "first" || len(perr.Stack) == 0 {
+		t.Errorf("re-raised (%v, %d byte stack), want the first panic with its stack", perr.Value, len(perr.Stack))
+	}
+	if results != nil {
+		t.Error("Run returned after re-raising")
+	}
+
+	// The re-raised panic is not raised again by the next batch.
+	if v := recovered(func() {
+		Run(WithItems(1), propagate, WithNoDelay(), WithLogger(nopLogger{}))
+	}); v != nil {
+		t.Errorf("a clean batch re-raised %v", v)
+	}
+}
+
+func TestPanicPropagationPoolWait(t *testing.T) {
+	p := newStartedPool(t, 2, WithPanicPropagation())
+	if err := p.Submit(panicFetcher{"boom"}); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	v := recovered(p.Wait)
+	if perr, ok := v.(*PanicError); !ok || perr.Value != "boom" {
+		t.Errorf("Wait panicked with %v, want the worker's panic", v)
+	}
+}
+
+func TestWithoutPanicPropagationRecords(t *testing.T) {
+	var results []Result
+	if v := recovered(func() {
+		results, _ = Run(WithItems(panicFetcher{"boom"}), WithNoDelay(), WithLogger(nopLogger{}))
+	}); v != nil {
+		t.Fatalf("Run panicked with %v without WithPanicPropagation", v)
+	}
+	if len(results) != 1 || results[0].Kind != KindPanic || !errors.Is(results[0].Err, ErrProcessingPanic) {
+		t.Errorf("Results = %v, want the panic recorded", results)
+	}
+}
+
+// cancelPanicFetcher is a payload whose Fetch cancels its context, then
+// panics with value.
+type cancelPanicFetcher struct {
+	cancel context.CancelFunc
+	value  interface{}
+}
+
+func (f cancelPanicFetcher) Fetch(context.Context) (string, error) {
+	f.cancel()
+	panic(f.value)
+}
+
+func TestPanicAfterCancelReportedCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stats := new(Stats)
+	r := Classify(ctx, cancelPanicFetcher{cancel, "boom"}, WithNoDelay(), WithStats(stats), WithLogger(nopLogger{}))
+	if r.Kind != KindCancelled || !errors.Is(r.Err, context.Canceled) {
+		t.Fatalf("Result = (%s, %v), want cancelled", r.Kind, r.Err)
+	}
+	if r.Panic == nil || r.Panic.Value != "boom" || len(r.Panic.Stack) == 0 {
+		t.Fatalf("Result.Panic = %v, want the recovered panic with its stack", r.Panic)
+	}
+	if stats.Cancelled != 1 || stats.Unknown != 0 {
+		t.Errorf("Stats counted (cancelled %d, unknown %d), want the item as cancelled", stats.Cancelled, stats.Unknown)
+	}
+}
+
+func TestPanicWithLiveContextReportedPanic(t *testing.T) {
+	r := Classify(context.Background(), panicFetcher{"boom"}, WithNoDelay(), WithLogger(nopLogger{}))
+	var perr *PanicError
+	if r.Kind != KindPanic || !errors.As(r.Err, &perr) || perr.Value != "boom" {
+		t.Fatalf("Result = (%s, %v), want a panic Result", r.Kind, r.Err)
+	}
+	if r.Panic != nil {
+		t.Errorf("Result.Panic = %v, want it only set on cancelled items", r.Panic)
+	}
+}
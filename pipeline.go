@@ -0,0 +1,72 @@
+package main
+
+import "context"
+
+// Pipeline is a two-stage streaming workflow. Stage one classifies each
+// payload with the type switch used by processData; stage two applies a
+// user-supplied transform to every Result. The stages run in their own
+// goroutines, connected by a channel, so stage two works concurrently with
+// stage one and a slow transform applies backpressure to classification.
+type Pipeline struct {
+	transform func(Result) Result
+	buffer    int
+	opts      []Option
+}
+
+// NewPipeline returns a Pipeline whose second stage runs transform. buffer
+// is the capacity of the channel between the stages; zero makes it
+// unbuffered. A nil transform passes Results through unchanged.
+func NewPipeline(transform func(Result) Result, buffer int, opts ...Option) *Pipeline {
+	if transform == nil {
+		transform = func(r Result) Result { return r }
+	}
+	if buffer < 0 {
+		buffer = 0
+	}
+	return &Pipeline{transform: transform, buffer: buffer, opts: opts}
+}
+
+// Run starts both stages and returns the channel of transformed Results.
+// The channel is closed once in is exhausted and every Result has been
+// delivered, or as soon as ctx is cancelled.
+//
+// Each stage closes only the channel it sends on: stage one closes the
+// channel between the stages, stage two closes the returned channel. A
+// channel is therefore never closed while its sender may still use it.
+func (p *Pipeline) Run(ctx context.Context, in <-chan interface{}) <-chan Result {
+	o := newOptions(p.opts)
+	classified := make(chan Result, p.buffer)
+	out := make(chan Result)
+
+	go func() {
+		defer close(classified)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case data, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case classified <- classify(ctx, data, o):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for r := range classified {
+			select {
+			case out <- p.transform(r):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
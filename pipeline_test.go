@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipelineSlowSecondStage(t *testing.T) {
+	for _, buffer := range []int{0, 4} {
+		slow := func(r Result) Result {
+			time.Sleep(time.Millisecond)
+			r.Output = strings.ToUpper(r.Output)
+			return r
+		}
+		p := NewPipeline(slow, buffer, WithNoDelay(), WithLogger(nopLogger{}))
+
+		in := make(chan interface{})
+		go func() {
+			defer close(in)
+			for i := 0; i < 20; i++ {
+				in <- i
+			}
+		}()
+
+		n := 0
+		for r := range p.Run(context.Background(), in) {
+			if r.Kind != KindInt || !strings.HasPrefix(r.Output, "PROCESSED INT") {
+				t.Errorf("buffer %d: Result %+v not transformed", buffer, r)
+			}
+			n++
+		}
+		if n != 20 {
+			t.Errorf("buffer %d: %d Results, want 20", buffer, n)
+		}
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	for _, buffer := range []int{0, 4} {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := NewPipeline(nil, buffer, WithNoDelay(), WithLogger(nopLogger{}))
+		in := make(chan interface{}) // never closed
+
+		AssertNoGoroutineLeak(t, func() {
+			out := p.Run(ctx, in)
+			in <- 1
+			cancel()
+			// The input is never closed, so only the cancellation ends the stages.
+			select {
+			case <-waitClosed(out):
+			case <-time.After(time.Second):
+				t.Fatalf("buffer %d: output not closed after cancel", buffer)
+			}
+		})
+	}
+}
+
+// waitClosed drains ch in the background and returns a channel closed once
+// ch is.
+func waitClosed(ch <-chan Result) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	return done
+}
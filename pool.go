@@ -0,0 +1,784 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPoolClosed is returned by Submit once the pool has been shut down or
+// its context cancelled.
+var ErrPoolClosed = errors.New("worker pool is closed")
+
+// ErrDuplicateID is returned by SubmitWithID when an item with the same ID
+// is still queued or being processed.
+var ErrDuplicateID = errors.New("item ID already in the pool")
+
+// ErrItemCancelled is the cancellation cause recorded on the Result of an
+// item cancelled with CancelItem.
+var ErrItemCancelled = errors.New("item cancelled by user")
+
+// ErrPoolNotStarted is returned by Start on a child pool whose parent has not
+// been started yet, and by the blocking Submit methods when the queue of a
+// pool that has not been started is full, as no worker could ever make room.
+var ErrPoolNotStarted = errors.New("worker pool not started")
+
+// ErrSubmitTimeout is returned by SubmitWithTimeout when the queue stays
+// full for the whole timeout.
+var ErrSubmitTimeout = errors.New("worker pool queue full")
+
+// ErrPoolStarted is returned by Start when the pool is already running.
+var ErrPoolStarted = errors.New("worker pool already started")
+
+// DefaultPriority is the priority Submit and TrySubmit give their items.
+const DefaultPriority = 0
+
+// WorkerPool runs processData on submitted items using a set of worker
+// goroutines that share one queue. Workers take the highest-priority item
+// first, and items of equal priority in the order they were submitted. The
+// number of workers can be changed with Resize.
+type WorkerPool struct {
+	ctx    context.Context    // set by Start
+	cancel context.CancelFunc // set by Start
+	parent *WorkerPool        // set by NewChildPool
+	opts   []Option
+	o      *options // opts resolved, for the pool's own bookkeeping
+	clock  Clock
+
+	items   sync.WaitGroup // one count per submitted item
+	workers sync.WaitGroup // one count per worker goroutine
+
+	// mu guards every field below it. cond is broadcast whenever any of them
+	// changes, waking both workers waiting for an item and producers waiting
+	// for room in the queue.
+	//
+	// closeJobs is the only place closed is set. It is called by Shutdown
+	// and by the goroutine watching the pool's context; once closed, no item
+	// is accepted and the workers exit when the queue is empty.
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    jobQueue   // items any worker may take
+	lanes    []jobQueue // SubmitPartitioned items, one queue per worker slot
+	queued   int        // items in queue and lanes together
+	capacity int        // queued count at which Submit blocks
+	seq      uint64     // submission counter, for FIFO order within a priority
+	closed   bool
+	size     int    // number of workers the pool is meant to have
+	live     []bool // worker slots with a running goroutine
+	turn     int    // last lane given an unkeyed SubmitPartitioned item
+	paused   bool   // workers start no new item while set
+
+	// ids tracks the items submitted with SubmitWithID until they finish.
+	ids map[string]*itemState
+
+	results poolResults
+
+	flushOnce sync.Once // guards the sink Flush done by Shutdown
+	flushErr  error
+
+	// Latency accumulators, in nanoseconds, for items that were processed.
+	// Cancelled items are only counted in cancelled.
+	latencyTotal int64
+	latencyCount int64
+	latencyMax   int64
+	cancelled    int64
+}
+
+// job is one queued item.
+type job struct {
+	data     interface{}
+	priority int
+	seq      uint64
+	id       string    // set by SubmitWithID only
+	queuedAt time.Time // when push enqueued the job
+	depth    int       // Requeue generation, 0 for submitted items
+
+	partitioned bool   // set by SubmitPartitioned only
+	key         string // partition key given to SubmitPartitioned
+}
+
+// before reports whether j should be taken ahead of k.
+func (j job) before(k job) bool {
+	if j.priority != k.priority {
+		return j.priority > k.priority
+	}
+	return j.seq < k.seq
+}
+
+// itemState is the cancellation state of an item submitted with an ID.
+type itemState struct {
+	cancel    context.CancelCauseFunc // set once a worker has started the item
+	cancelled bool
+}
+
+// jobQueue is a container/heap of jobs, highest priority first and oldest
+// first within a priority.
+type jobQueue []job
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool { return q[i].before(q[j]) }
+
+func (q jobQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *jobQueue) Push(x interface{}) { *q = append(*q, x.(job)) }
+
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	j := old[len(old)-1]
+	old[len(old)-1] = job{}
+	*q = old[:len(old)-1]
+	return j
+}
+
+// NewWorkerPool allocates a pool of size workers, whose queue holds up to
+// size items. opts are applied to every processData call made by the
+// workers. No worker runs until Start is called; items submitted before then
+// wait in the queue, and Submit blocks once it is full. It returns the
+// errors of every invalid Option, as Validate does, instead of a pool, along
+// with an *OptionError for a size below 1.
+func NewWorkerPool(size int, opts ...Option) (*WorkerPool, error) {
+	p := &WorkerPool{capacity: size, size: size}
+	p.cond = sync.NewCond(&p.mu)
+
+	// Every Result is also offered to the channel returned by Results.
+	p.opts = append(opts[:len(opts):len(opts)], withCollector(p.results.collect))
+	p.o = newOptions(p.opts)
+	if size < 1 {
+		p.o.reject("NewWorkerPool", size, "size must be positive")
+	}
+	if err := p.o.validate(); err != nil {
+		return nil, err
+	}
+	p.clock = p.o.clk()
+	return p, nil
+}
+
+// NewWorkerPoolWithContext allocates a pool with NewWorkerPool and starts it
+// under ctx.
+func NewWorkerPoolWithContext(ctx context.Context, size int, opts ...Option) (*WorkerPool, error) {
+	p, err := NewWorkerPool(size, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return p, p.Start(ctx)
+}
+
+// NewChildPool allocates a pool like NewWorkerPool whose context, once
+// started, also derives from parent's: cancelling the parent, or shutting it
+// down either way, cancels the child's items like cancelling its own context
+// would. The child is started and stopped on its own, and stopping it does
+// not affect the parent. Start returns ErrPoolNotStarted while the parent
+// has not been started.
+func NewChildPool(parent *WorkerPool, size int, opts ...Option) (*WorkerPool, error) {
+	p, err := NewWorkerPool(size, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.parent = parent
+	return p, nil
+}
+
+// Start launches the workers. shutdownCtx controls the lifetime of the pool
+// and of nothing else: cancelling it stops the pool, no further items are
+// accepted and items still queued are handed to processData with a
+// cancelled context, so they return promptly. Each item runs under its own
+// work context derived from it, which can be cancelled on its own with
+// CancelItem and carries the WithItemTimeout deadline. Start returns
+// ErrPoolStarted if the pool is already running and ErrPoolClosed once it
+// has been stopped.
+func (p *WorkerPool) Start(shutdownCtx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.closed:
+		return ErrPoolClosed
+	case p.ctx != nil:
+		return ErrPoolStarted
+	}
+
+	// A child pool is cancelled by its parent too. The registration is
+	// dropped by the watcher below once the child stops, so a stopped child
+	// leaves nothing behind on a still-running parent.
+	var parentCtx context.Context
+	if p.parent != nil {
+		var err error
+		if parentCtx, err = p.parent.baseContext(); err != nil {
+			return err
+		}
+	}
+
+	p.ctx, p.cancel = context.WithCancel(shutdownCtx)
+	stopParent := func() bool { return false }
+	if parentCtx != nil {
+		stopParent = context.AfterFunc(parentCtx, p.cancel)
+	}
+
+	for slot := 0; slot < p.size; slot++ {
+		p.startWorker(slot)
+	}
+
+	go func(ctx context.Context) {
+		<-ctx.Done()
+		stopParent()
+		p.closeJobs()
+	}(p.ctx)
+
+	// The worker count never drops to zero while the pool runs, so this
+	// only returns once the pool has stopped and its last worker exited.
+	go func() {
+		p.workers.Wait()
+		p.results.finish()
+	}()
+
+	return nil
+}
+
+// baseContext returns the pool's context, or ErrPoolNotStarted before Start.
+func (p *WorkerPool) baseContext() (context.Context, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ctx == nil {
+		return nil, ErrPoolNotStarted
+	}
+	return p.ctx, nil
+}
+
+// Stop drains the pool: it stops accepting items and returns once every
+// queued item has been processed and the workers have exited. It is
+// Shutdown(true).
+func (p *WorkerPool) Stop() error {
+	return p.Shutdown(true)
+}
+
+// startWorker launches the worker for slot. The caller holds mu.
+func (p *WorkerPool) startWorker(slot int) {
+	for len(p.live) <= slot {
+		p.live = append(p.live, false)
+	}
+	p.live[slot] = true
+	p.workers.Add(1)
+	go p.worker(slot)
+}
+
+// worker processes items until the pool is closed and its queue empty, or
+// until a shrinking Resize leaves its slot out of the pool. Both are only
+// looked at between items, so a worker never abandons an item it has
+// started.
+func (p *WorkerPool) worker(slot int) {
+	defer p.workers.Done()
+
+	for {
+		j, ok := p.next(slot)
+		if !ok {
+			return
+		}
+		ctx, done := p.itemContext(j.id)
+		ctx = context.WithValue(p.o.withItemIndex(ctx, int(j.seq)), workerIDKey, slot)
+		ctx = context.WithValue(ctx, requeueKey, requeueTarget{pool: p, depth: j.depth})
+		start := p.clock.Now()
+		opts := append(p.opts[:len(p.opts):len(p.opts)], withEnqueuedAt(j.queuedAt))
+		// The item is only counted as finished by Wait once its latency is
+		// recorded and its ID released, so both are settled when Wait
+		// returns.
+		err := processData(ctx, nil, j.data, nil, opts...)
+		p.observe(p.clock.Now().Sub(start), err)
+		done()
+		p.items.Done()
+	}
+}
+
+// itemContext returns the work context a worker processes the item with ID
+// id under, and the function to call once it is finished, which cancels it.
+// Every item gets its own work context, derived from the pool's shutdown
+// context, so cancelling one item never reaches the pool or its siblings,
+// while stopping the pool cancels every item. The per-item deadline, if
+// any, is only added by processData, so it never bounds the pool itself.
+func (p *WorkerPool) itemContext(id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(p.ctx)
+	if id == "" {
+		return ctx, func() { cancel(nil) }
+	}
+
+	p.mu.Lock()
+	st := p.ids[id]
+	st.cancel = cancel
+	if st.cancelled {
+		cancel(ErrItemCancelled)
+	}
+	p.mu.Unlock()
+
+	return ctx, func() {
+		p.mu.Lock()
+		delete(p.ids, id)
+		p.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// CancelItem cancels the item submitted with ID id, whether it is still
+// queued or already being processed. Its Result is reported as cancelled,
+// with ErrItemCancelled as the cause, and the other items are unaffected.
+// Cancelling an unknown or finished ID is a no-op.
+func (p *WorkerPool) CancelItem(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st, ok := p.ids[id]
+	if !ok {
+		return
+	}
+	st.cancelled = true
+	if st.cancel != nil {
+		st.cancel(ErrItemCancelled)
+	}
+}
+
+// next blocks until there is an item for the worker of slot and pops it. It
+// reports false when the worker should exit instead.
+func (p *WorkerPool) next(slot int) (job, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if slot >= p.size {
+			p.live[slot] = false
+			return job{}, false
+		}
+		// A cancelled pool ignores Pause so queued items are reported as
+		// cancelled rather than held forever.
+		if !p.paused || p.ctx.Err() != nil {
+			if j, ok := p.pop(slot); ok {
+				p.cond.Broadcast()
+				return j, true
+			}
+		}
+		if p.closed && p.queued == 0 {
+			return job{}, false
+		}
+		p.cond.Wait()
+	}
+}
+
+// pop takes the next item for the worker of slot, from the shared queue or
+// the slot's own lane, whichever holds the item to be taken first. The
+// caller holds mu.
+func (p *WorkerPool) pop(slot int) (job, bool) {
+	shared := len(p.queue) > 0
+	own := slot < len(p.lanes) && len(p.lanes[slot]) > 0
+
+	var j job
+	switch {
+	case own && (!shared || p.lanes[slot][0].before(p.queue[0])):
+		j = heap.Pop(&p.lanes[slot]).(job)
+	case shared:
+		j = heap.Pop(&p.queue).(job)
+	default:
+		return job{}, false
+	}
+	p.queued--
+	return j, true
+}
+
+// Pause stops the workers from starting new items until Resume is called.
+// Items already being processed run to completion, and Submit keeps
+// enqueuing while the pool is paused until the queue is full. Cancelling the
+// pool's context, or a Shutdown, lifts the pause. Pausing a paused pool is a
+// no-op.
+func (p *WorkerPool) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.paused = true
+}
+
+// Resume lets the workers held by Pause pick up items again. Resuming a
+// running pool is a no-op.
+func (p *WorkerPool) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.paused = false
+	p.cond.Broadcast()
+}
+
+// Resize changes the number of workers to n, which is raised to 1 if
+// smaller. Growing starts the extra workers straight away. Shrinking tells
+// the surplus workers to exit as soon as they have finished their current
+// item, so in-flight and queued items are never dropped. Resize is safe to
+// call concurrently with Submit and is a no-op once the pool has stopped.
+// The queue capacity set by the constructor is left unchanged.
+func (p *WorkerPool) Resize(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	// Holding mu keeps closeJobs, and so Shutdown's wait for the workers,
+	// from running while workers are being added.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+
+	// Before Start only the worker count changes. Afterwards, slots still
+	// running a worker told to exit by an earlier shrink keep it.
+	if p.ctx != nil {
+		for slot := p.size; slot < n; slot++ {
+			if slot >= len(p.live) || !p.live[slot] {
+				p.startWorker(slot)
+			}
+		}
+	}
+	if n != p.size {
+		p.size = n
+		p.rehash()
+		p.cond.Broadcast()
+	}
+}
+
+// rehash spreads the partitioned items over the lanes of the current worker
+// slots, keeping their submission order. The caller holds mu.
+func (p *WorkerPool) rehash() {
+	var moved jobQueue
+	for _, lane := range p.lanes {
+		moved = append(moved, lane...)
+	}
+	sort.Sort(moved)
+
+	p.lanes = make([]jobQueue, p.size)
+	for _, j := range moved {
+		heap.Push(&p.lanes[p.lane(j.key)], j)
+	}
+}
+
+// lane returns the worker slot whose lane holds the items partitioned by
+// key: its FNV-1a hash modulo the worker count, or the next slot in turn for
+// an empty key. The caller holds mu.
+func (p *WorkerPool) lane(key string) int {
+	if key == "" {
+		p.turn = (p.turn + 1) % p.size
+		return p.turn
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(p.size))
+}
+
+// Size reports the number of workers set by the constructor or the latest
+// Resize. Workers told to exit by a shrink may still be finishing an item.
+func (p *WorkerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// observe records how long one processData call took.
+func (p *WorkerPool) observe(d time.Duration, err error) {
+	if errors.Is(err, ErrContextCancelled) {
+		atomic.AddInt64(&p.cancelled, 1)
+		return
+	}
+
+	atomic.AddInt64(&p.latencyTotal, int64(d))
+	atomic.AddInt64(&p.latencyCount, 1)
+	for {
+		max := atomic.LoadInt64(&p.latencyMax)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&p.latencyMax, max, int64(d)) {
+			return
+		}
+	}
+}
+
+// AverageLatency reports the mean time from dequeue to completion of the
+// items processed so far, excluding cancelled items.
+func (p *WorkerPool) AverageLatency() time.Duration {
+	n := atomic.LoadInt64(&p.latencyCount)
+	if n == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&p.latencyTotal) / n)
+}
+
+// MaxLatency reports the longest time from dequeue to completion of any
+// item processed so far, excluding cancelled items.
+func (p *WorkerPool) MaxLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.latencyMax))
+}
+
+// CancelledCount reports how many items were cancelled rather than
+// processed. They are left out of the latency figures.
+func (p *WorkerPool) CancelledCount() int64 {
+	return atomic.LoadInt64(&p.cancelled)
+}
+
+// closeJobs stops the pool from accepting items and wakes every waiter. It
+// is safe to call more than once.
+func (p *WorkerPool) closeJobs() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.cond.Broadcast()
+}
+
+// Submit enqueues data at DefaultPriority, blocking while the queue is full.
+// It returns ErrPoolClosed, without enqueuing, once the pool has been shut
+// down or its context cancelled. Before Start, items are buffered up to the
+// queue capacity; past it Submit returns ErrPoolNotStarted instead of
+// blocking forever.
+func (p *WorkerPool) Submit(data interface{}) error {
+	return p.SubmitWithPriority(data, DefaultPriority)
+}
+
+// waitForRoom blocks until the queue has room for one more item. It returns
+// ErrPoolClosed once the pool is closed and ErrPoolNotStarted if the queue
+// is full before Start. The caller holds mu.
+func (p *WorkerPool) waitForRoom() error {
+	for {
+		switch {
+		case p.closed:
+			return ErrPoolClosed
+		case p.queued < p.capacity:
+			return nil
+		case p.ctx == nil:
+			return ErrPoolNotStarted
+		}
+		p.cond.Wait()
+	}
+}
+
+// SubmitWithPriority is Submit for an item that workers should take ahead
+// of every queued item of lower priority. Items of equal priority are taken
+// in the order they were submitted.
+func (p *WorkerPool) SubmitWithPriority(data interface{}, priority int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.waitForRoom(); err != nil {
+		return err
+	}
+
+	p.push(job{data: data, priority: priority})
+	return nil
+}
+
+// SubmitWithTimeout is Submit giving up with ErrSubmitTimeout if the queue
+// is still full after timeout, so producers can shed load instead of
+// blocking on stuck workers. A timeout of zero or less makes it TrySubmit,
+// returning at once. The timeout runs on the pool's Clock and its timer is
+// stopped as soon as the call returns.
+func (p *WorkerPool) SubmitWithTimeout(data interface{}, timeout time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	full := func() bool { return p.queued >= p.capacity }
+	if timeout > 0 && !p.closed && full() {
+		expired := false
+		stop := afterFunc(p.clock, timeout, func() {
+			p.mu.Lock()
+			expired = true
+			p.cond.Broadcast()
+			p.mu.Unlock()
+		})
+		defer stop()
+
+		for !p.closed && full() && !expired {
+			p.cond.Wait()
+		}
+	}
+
+	switch {
+	case p.closed:
+		return ErrPoolClosed
+	case full():
+		return ErrSubmitTimeout
+	}
+	p.push(job{data: data, priority: DefaultPriority})
+	return nil
+}
+
+// SubmitWithID is Submit for an item that can later be cancelled on its own
+// with CancelItem(id). It returns ErrDuplicateID if an item submitted with
+// the same ID has not finished yet. An empty id makes it Submit.
+func (p *WorkerPool) SubmitWithID(id string, data interface{}) error {
+	if id == "" {
+		return p.Submit(data)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.waitForRoom(); err != nil {
+		return err
+	}
+	if _, ok := p.ids[id]; ok {
+		return ErrDuplicateID
+	}
+
+	if p.ids == nil {
+		p.ids = make(map[string]*itemState)
+	}
+	p.ids[id] = &itemState{}
+	p.push(job{data: data, priority: DefaultPriority, id: id})
+	return nil
+}
+
+// SubmitPartitioned is Submit for an item that must be processed by the
+// same worker as every other item submitted with the same key, and after
+// the ones submitted before it. The worker is picked by hashing key modulo
+// the number of workers, so each key sticks to one worker while the pool
+// keeps its size; an empty key picks the workers in turn instead. Resize
+// rehashes the queued items over the new set of workers, so from then on a
+// key may move to another worker, and its first item there may start before
+// the item it was last processing. A worker still takes shared items,
+// submitted without a key, between its partitioned ones. WorkerIDFromContext
+// reports the worker processing an item.
+func (p *WorkerPool) SubmitPartitioned(key string, data interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.waitForRoom(); err != nil {
+		return err
+	}
+
+	p.push(job{data: data, priority: DefaultPriority, partitioned: true, key: key})
+	return nil
+}
+
+// push enqueues j and wakes the workers. The caller holds mu.
+func (p *WorkerPool) push(j job) {
+	p.items.Add(1)
+	j.seq = p.seq
+	p.seq++
+	j.queuedAt = p.clock.Now()
+	p.o.events.append(j.queuedAt, int(j.seq), "enqueued")
+	if j.partitioned {
+		if len(p.lanes) != p.size {
+			p.rehash()
+		}
+		heap.Push(&p.lanes[p.lane(j.key)], j)
+	} else {
+		heap.Push(&p.queue, j)
+	}
+	p.queued++
+	p.cond.Broadcast()
+}
+
+// Wait blocks until every submitted item has been processed.
+func (p *WorkerPool) Wait() {
+	p.items.Wait()
+	p.o.repanic()
+}
+
+// TrySubmit enqueues data at DefaultPriority only if the queue has room,
+// returning false instead of blocking when it is full or the pool has
+// stopped. It is safe to call from many producers at once.
+func (p *WorkerPool) TrySubmit(data interface{}) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || p.queued >= p.capacity {
+		return false
+	}
+
+	p.push(job{data: data, priority: DefaultPriority})
+	return true
+}
+
+// QueueLen reports how many submitted items are waiting for a worker.
+func (p *WorkerPool) QueueLen() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queued
+}
+
+// Pending returns a snapshot of the payloads waiting for a worker, in the
+// order the workers would take them. The slice is the caller's to keep; the
+// queue itself is left untouched and workers are only held off for the time
+// it takes to copy it.
+func (p *WorkerPool) Pending() []interface{} {
+	p.mu.Lock()
+	queue := append(jobQueue(nil), p.queue...)
+	for _, lane := range p.lanes {
+		queue = append(queue, lane...)
+	}
+	p.mu.Unlock()
+
+	sort.Sort(queue)
+	pending := make([]interface{}, len(queue))
+	for i, j := range queue {
+		pending[i] = j.data
+	}
+	return pending
+}
+
+// PendingCount reports how many submitted items are waiting for a worker,
+// like QueueLen.
+func (p *WorkerPool) PendingCount() int {
+	return p.QueueLen()
+}
+
+// Shutdown stops the pool and waits for every worker to exit.
+//
+// With drain set, the pool stops accepting items and the workers finish
+// everything already queued, resuming a paused pool to do so. Otherwise the
+// pool's context is cancelled: each worker stops after its current item,
+// and items still queued are handed to processData with the cancelled
+// context, so they are reported as cancelled without being processed. On a
+// pool that was never started, queued items are discarded.
+//
+// Once the workers have exited, the ResultSink set by WithSink, if any, is
+// flushed and Shutdown returns its Flush error. The sink is flushed only by
+// the first Shutdown, after the last Result was emitted; later calls return
+// the same error.
+//
+// Submit returns ErrPoolClosed once Shutdown has been called. Calling
+// Shutdown more than once is safe.
+func (p *WorkerPool) Shutdown(drain bool) error {
+	p.mu.Lock()
+	cancel := p.cancel
+	if cancel == nil {
+		for ; p.queued > 0; p.queued-- {
+			p.items.Done()
+		}
+		p.queue, p.lanes = nil, nil
+	}
+	p.mu.Unlock()
+
+	if cancel == nil {
+		p.closeJobs()
+		p.results.finish()
+		return p.flush()
+	}
+
+	if !drain {
+		cancel()
+	}
+	p.closeJobs()
+	p.Resume()
+	p.workers.Wait()
+
+	// Release the context watcher started by Start.
+	cancel()
+	return p.flush()
+}
+
+// flush flushes the pool's sink on the first call and returns the outcome
+// of that call every time.
+func (p *WorkerPool) flush() error {
+	p.flushOnce.Do(func() {
+		if p.o.sink != nil {
+			p.flushErr = p.o.sink.Flush()
+		}
+	})
+	return p.flushErr
+}
@@ -0,0 +1,1080 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newStartedPool returns a started pool of size workers that logs nothing
+// and does no simulated work, shut down when the test ends.
+func newStartedPool(t *testing.T, size int, opts ...Option) *WorkerPool {
+	t.Helper()
+	p, err := NewWorkerPool(size, append([]Option{WithNoDelay(), WithLogger(nopLogger{})}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { p.Shutdown(false) })
+	return p
+}
+
+func TestPoolLatencyCompleteAfterWait(t *testing.T) {
+	p := newStartedPool(t, 4)
+	const n = 100
+	for i := 0; i < n; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	p.Wait()
+
+	// No Result is cancelled, so every item must be in the latency figures.
+	if got := atomic.LoadInt64(&p.latencyCount); got != n {
+		t.Errorf("latencyCount after Wait = %d, want %d", got, n)
+	}
+	if p.CancelledCount() != 0 {
+		t.Errorf("CancelledCount = %d, want 0", p.CancelledCount())
+	}
+}
+
+func TestPoolSubmitWithIDReusableAfterWait(t *testing.T) {
+	p := newStartedPool(t, 2)
+	for i := 0; i < 50; i++ {
+		if err := p.SubmitWithID("x", i); err != nil {
+			t.Fatalf("SubmitWithID #%d: %v", i, err)
+		}
+		p.Wait()
+	}
+}
+
+func TestPoolShutdownNoLeak(t *testing.T) {
+	for _, drain := range []bool{true, false} {
+		AssertNoGoroutineLeak(t, func() {
+			p, err := NewWorkerPool(4, WithWorkDuration(time.Millisecond), WithLogger(nopLogger{}))
+			if err != nil {
+				t.Fatalf("NewWorkerPool: %v", err)
+			}
+			if err := p.Start(context.Background()); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			for i := 0; i < 4; i++ {
+				if err := p.Submit(i); err != nil {
+					t.Fatalf("Submit: %v", err)
+				}
+			}
+			if err := p.Shutdown(drain); err != nil {
+				t.Fatalf("Shutdown(%v): %v", drain, err)
+			}
+		})
+	}
+}
+
+// recordingSink is a ResultSink keeping every Result it is given.
+type recordingSink struct {
+	mu      sync.Mutex
+	results []Result
+	flushes int
+}
+
+func (s *recordingSink) Emit(r Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, r)
+	return nil
+}
+
+func (s *recordingSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	return nil
+}
+
+// Results returns a copy of the Results emitted so far.
+func (s *recordingSink) Results() []Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Result(nil), s.results...)
+}
+
+func TestPoolProcessesEachItemOnce(t *testing.T) {
+	sink := new(recordingSink)
+	p := newStartedPool(t, 4, WithSink(sink))
+	const n = 1000
+	for i := 0; i < n; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit(%d): %v", i, err)
+		}
+	}
+	p.Wait()
+
+	seen := make(map[interface{}]int)
+	for _, r := range sink.Results() {
+		if r.Kind != KindInt {
+			t.Errorf("Result %v has Kind %s", r.Input, r.Kind)
+		}
+		seen[r.Input]++
+	}
+	for i := 0; i < n; i++ {
+		if seen[i] != 1 {
+			t.Errorf("item %d processed %d times", i, seen[i])
+		}
+	}
+}
+
+func TestPoolContextCancelStopsWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := new(recordingSink)
+	p, err := NewWorkerPoolWithContext(ctx, 2, WithWorkDuration(time.Hour), WithLogger(nopLogger{}), WithSink(sink))
+	if err != nil {
+		t.Fatalf("NewWorkerPoolWithContext: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("workers still busy after the pool's context was cancelled")
+	}
+	for _, r := range sink.Results() {
+		if r.Kind != KindCancelled {
+			t.Errorf("Result %v has Kind %s, want cancelled", r.Input, r.Kind)
+		}
+	}
+	// The pool closes itself shortly after its context is cancelled.
+	waitFor(t, func() bool { return !p.Health().Running })
+	if err := p.Submit(3); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("Submit after cancel = %v, want ErrPoolClosed", err)
+	}
+}
+
+// heldFetcher is a payload whose Fetch signals started and then blocks until
+// release is closed or its context is done, holding its worker busy.
+type heldFetcher struct {
+	started chan<- struct{}
+	release <-chan struct{}
+}
+
+func (f heldFetcher) Fetch(ctx context.Context) (string, error) {
+	f.started <- struct{}{}
+	select {
+	case <-f.release:
+		return "released", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// holdWorkers submits one heldFetcher per worker of p and returns once each
+// is running, along with the func releasing them.
+func holdWorkers(t *testing.T, p *WorkerPool, n int) (release func()) {
+	t.Helper()
+	started, ch := make(chan struct{}, n), make(chan struct{})
+	for i := 0; i < n; i++ {
+		if err := p.Submit(heldFetcher{started, ch}); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		<-started
+	}
+	var once sync.Once
+	release = func() { once.Do(func() { close(ch) }) }
+	t.Cleanup(release)
+	return release
+}
+
+func TestPoolTrySubmitFull(t *testing.T) {
+	p := newStartedPool(t, 1)
+	release := holdWorkers(t, p, 1)
+
+	if !p.TrySubmit(1) {
+		t.Fatal("TrySubmit into an empty queue returned false")
+	}
+	if got := p.QueueLen(); got != 1 {
+		t.Fatalf("QueueLen = %d, want 1", got)
+	}
+
+	// Many producers race for no room at all.
+	var wg sync.WaitGroup
+	var accepted int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if p.TrySubmit(i) {
+				atomic.AddInt32(&accepted, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if accepted != 0 {
+		t.Fatalf("TrySubmit accepted %d items into a full queue", accepted)
+	}
+
+	release()
+	p.Wait()
+	if !p.TrySubmit(2) {
+		t.Fatal("TrySubmit returned false once the queue drained")
+	}
+}
+
+func TestPoolShutdownDrain(t *testing.T) {
+	stats := new(Stats)
+	p, err := NewWorkerPool(1, WithWorkDuration(2*time.Millisecond), WithStats(stats), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	if err := p.Shutdown(true); err != nil {
+		t.Fatalf("Shutdown(true): %v", err)
+	}
+	if stats.Completed != 5 || stats.Cancelled != 0 {
+		t.Fatalf("Completed = %d, Cancelled = %d, want every queued item processed", stats.Completed, stats.Cancelled)
+	}
+	if err := p.Submit(6); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("Submit after Shutdown = %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestPoolShutdownAbort(t *testing.T) {
+	stats := new(Stats)
+	p, err := NewWorkerPool(2, WithWorkDuration(time.Hour), WithStats(stats), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+
+	if err := p.Shutdown(false); err != nil {
+		t.Fatalf("Shutdown(false): %v", err)
+	}
+	if stats.Completed != 0 || stats.Cancelled != 4 {
+		t.Fatalf("Completed = %d, Cancelled = %d, want every item cancelled", stats.Completed, stats.Cancelled)
+	}
+	if err := p.Submit(5); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("Submit after Shutdown = %v, want ErrPoolClosed", err)
+	}
+	if err := p.Shutdown(false); err != nil {
+		t.Fatalf("second Shutdown: %v", err)
+	}
+}
+
+func TestPoolAverageLatencyFakeClock(t *testing.T) {
+	c := newManualClock()
+	p, err := NewWorkerPool(1, WithClock(c), WithWorkDuration(time.Second), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer p.Shutdown(false)
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			p.Submit(i)
+		}
+	}()
+	// The single worker takes one item at a time; let the first take 1s
+	// and the second 3s.
+	for _, d := range []time.Duration{time.Second, 3 * time.Second} {
+		waitFor(t, func() bool { return c.Waiters() == 1 })
+		c.Advance(d)
+	}
+	waitFor(t, func() bool { return atomic.LoadInt64(&p.latencyCount) == 2 })
+
+	if got := p.AverageLatency(); got != 2*time.Second {
+		t.Errorf("AverageLatency = %v, want 2s", got)
+	}
+	if got := p.MaxLatency(); got != 3*time.Second {
+		t.Errorf("MaxLatency = %v, want 3s", got)
+	}
+}
+
+func TestPoolLatencyExcludesCancelled(t *testing.T) {
+	p := newStartedPool(t, 1)
+	p.observe(time.Second, nil)
+	p.observe(time.Hour, &CancelledError{})
+	if p.AverageLatency() != time.Second || p.MaxLatency() != time.Second || p.CancelledCount() != 1 {
+		t.Fatalf("AverageLatency %v, MaxLatency %v, CancelledCount %d, want the cancelled item left out",
+			p.AverageLatency(), p.MaxLatency(), p.CancelledCount())
+	}
+}
+
+// gauge tracks how many trackedFetchers run at once.
+type gauge struct {
+	mu       sync.Mutex
+	cur, max int
+}
+
+func (g *gauge) add(d int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cur += d
+	g.max = max(g.max, g.cur)
+}
+
+// Max returns the peak and resets it to the current count.
+func (g *gauge) Max() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	m := g.max
+	g.max = g.cur
+	return m
+}
+
+// trackedFetcher is a payload taking d to Fetch, counted in g meanwhile.
+type trackedFetcher struct {
+	g *gauge
+	d time.Duration
+}
+
+func (f trackedFetcher) Fetch(context.Context) (string, error) {
+	f.g.add(1)
+	defer f.g.add(-1)
+	time.Sleep(f.d)
+	return "done", nil
+}
+
+func TestPoolResizeGrowAndShrink(t *testing.T) {
+	g := new(gauge)
+	p := newStartedPool(t, 2)
+
+	batch := func() time.Duration {
+		start := time.Now()
+		for i := 0; i < 16; i++ {
+			if err := p.Submit(trackedFetcher{g, 10 * time.Millisecond}); err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+		}
+		p.Wait()
+		return time.Since(start)
+	}
+
+	slow := batch()
+	if m := g.Max(); m > 2 {
+		t.Fatalf("%d items ran at once on 2 workers", m)
+	}
+
+	// Grow while the next batch is being submitted.
+	go p.Resize(8)
+	fast := batch()
+	if p.Size() != 8 {
+		t.Fatalf("Size = %d, want 8", p.Size())
+	}
+	if fast >= slow {
+		t.Errorf("16 items took %v on 8 workers and %v on 2, want faster", fast, slow)
+	}
+	g.Max()
+
+	p.Resize(1)
+	batch()
+	if p.Size() != 1 {
+		t.Fatalf("Size = %d, want 1", p.Size())
+	}
+	// Workers told to exit may still be finishing their last item, so
+	// check a second batch run entirely after the shrink.
+	g.Max()
+	batch()
+	if m := g.Max(); m > 1 {
+		t.Fatalf("%d items ran at once after shrinking to 1", m)
+	}
+}
+
+func TestPoolPauseResume(t *testing.T) {
+	sink := new(recordingSink)
+	const n = 4 // the queue holds as many items as the pool has workers
+	p := newStartedPool(t, n, WithSink(sink))
+	release := holdWorkers(t, p, 1)
+
+	p.Pause()
+	release()
+	waitFor(t, func() bool { return len(sink.Results()) == 1 })
+	if r := sink.Results()[0]; r.Output != "Processed Fetch: released" {
+		t.Errorf("running item finished with %q, want it left running by Pause", r.Output)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit while paused: %v", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := len(sink.Results()); got != 1 {
+		t.Fatalf("%d items completed while paused, want none", got-1)
+	}
+	if got := p.QueueLen(); got != n {
+		t.Errorf("QueueLen() = %d while paused, want %d", got, n)
+	}
+
+	p.Resume()
+	p.Wait()
+	if got := len(sink.Results()); got != n+1 {
+		t.Errorf("%d items completed after Resume, want %d", got-1, n)
+	}
+}
+
+func TestPoolSubmitWithPriority(t *testing.T) {
+	sink := new(recordingSink)
+	// A single worker makes the order it takes items the order they finish.
+	// The pool is built with 4 for a queue that holds 4 items.
+	p := newStartedPool(t, 4, WithSink(sink))
+	release := holdWorkers(t, p, 4)
+	p.Resize(1)
+
+	for _, low := range []int{1, 2, 3} {
+		if err := p.Submit(low); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	if err := p.SubmitWithPriority(99, DefaultPriority+1); err != nil {
+		t.Fatalf("SubmitWithPriority: %v", err)
+	}
+	release()
+	p.Wait()
+
+	var order []interface{}
+	for _, r := range sink.Results() {
+		if r.Kind == KindInt {
+			order = append(order, r.Input)
+		}
+	}
+	if want := []interface{}{99, 1, 2, 3}; !reflect.DeepEqual(order, want) {
+		t.Errorf("items ran in order %v, want %v", order, want)
+	}
+}
+
+func TestPoolStartTwice(t *testing.T) {
+	p := newStartedPool(t, 1)
+	if err := p.Start(context.Background()); !errors.Is(err, ErrPoolStarted) {
+		t.Errorf("second Start: %v, want ErrPoolStarted", err)
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := p.Start(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Start after Stop: %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestPoolSubmitBeforeStart(t *testing.T) {
+	sink := new(recordingSink)
+	p, err := NewWorkerPool(2, WithNoDelay(), WithLogger(nopLogger{}), WithSink(sink))
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit before Start: %v", err)
+		}
+	}
+	if p.TrySubmit(2) {
+		t.Error("TrySubmit accepted an item past the queue capacity")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := len(sink.Results()); got != 0 {
+		t.Fatalf("%d items processed before Start", got)
+	}
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if got := len(sink.Results()); got != 2 {
+		t.Errorf("%d buffered items processed after Start, want 2", got)
+	}
+}
+
+func TestPoolSubmitPastCapacityBeforeStart(t *testing.T) {
+	sink := new(recordingSink)
+	p, err := NewWorkerPool(2, WithNoDelay(), WithLogger(nopLogger{}), WithSink(sink))
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit before Start: %v", err)
+		}
+	}
+
+	submits := map[string]func() error{
+		"Submit":             func() error { return p.Submit(2) },
+		"SubmitWithPriority": func() error { return p.SubmitWithPriority(2, 1) },
+		"SubmitWithID":       func() error { return p.SubmitWithID("c", 2) },
+		"SubmitPartitioned":  func() error { return p.SubmitPartitioned("k", 2) },
+	}
+	for name, submit := range submits {
+		errc := make(chan error, 1)
+		go func() { errc <- submit() }()
+		select {
+		case err := <-errc:
+			if !errors.Is(err, ErrPoolNotStarted) {
+				t.Errorf("%s past capacity before Start = %v, want ErrPoolNotStarted", name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s past capacity before Start blocked", name)
+		}
+	}
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if got := len(sink.Results()); got != 2 {
+		t.Errorf("%d items processed, want the 2 buffered before Start", got)
+	}
+}
+
+func TestPoolStartSubmitStop(t *testing.T) {
+	sink := new(recordingSink)
+	p := newStartedPool(t, 4, WithSink(sink))
+	const n = 50
+	for i := 0; i < n; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if got := len(sink.Results()); got != n {
+		t.Errorf("Stop returned after %d items, want all %d", got, n)
+	}
+	if err := p.Submit(n); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Submit after Stop: %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestPoolCancelItem(t *testing.T) {
+	sink := new(recordingSink)
+	p, err := NewWorkerPool(3, WithWorkDuration(100*time.Millisecond), WithLogger(nopLogger{}), WithSink(sink))
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { p.Shutdown(false) })
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := p.SubmitWithID(id, i); err != nil {
+			t.Fatalf("SubmitWithID(%q): %v", id, err)
+		}
+	}
+	p.CancelItem("b")
+	p.CancelItem("unknown")
+	p.Wait()
+	p.CancelItem("a") // finished
+
+	results := sink.Results()
+	if len(results) != 3 {
+		t.Fatalf("got %d Results, want 3", len(results))
+	}
+	for _, r := range results {
+		// Item "b" carries 1.
+		cancelled := r.Kind == KindCancelled && errors.Is(r.CancelCause, ErrItemCancelled)
+		if cancelled != (r.Input == 1) {
+			t.Errorf("item %v finished as (%s, cause %v)", r.Input, r.Kind, r.CancelCause)
+		}
+	}
+}
+
+func TestChildPoolCancelledByParent(t *testing.T) {
+	AssertNoGoroutineLeak(t, func() {
+		parent := newStartedPool(t, 1)
+		sink := new(recordingSink)
+		child, err := NewChildPool(parent, 2, WithNoDelay(), WithLogger(nopLogger{}), WithSink(sink))
+		if err != nil {
+			t.Fatalf("NewChildPool: %v", err)
+		}
+		if err := child.Start(context.Background()); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		holdWorkers(t, child, 2)
+
+		parent.Shutdown(false)
+		if err := child.Stop(); err != nil {
+			t.Fatalf("child Stop: %v", err)
+		}
+		results := sink.Results()
+		if len(results) != 2 {
+			t.Fatalf("got %d Results, want 2", len(results))
+		}
+		for _, r := range results {
+			if !errors.Is(r.Err, context.Canceled) {
+				t.Errorf("in-flight child item finished with %v, want context.Canceled", r.Err)
+			}
+		}
+	})
+}
+
+func TestChildPoolStopLeavesParent(t *testing.T) {
+	AssertNoGoroutineLeak(t, func() {
+		sink := new(recordingSink)
+		parent := newStartedPool(t, 1, WithSink(sink))
+		child, err := NewChildPool(parent, 1, WithNoDelay(), WithLogger(nopLogger{}))
+		if err != nil {
+			t.Fatalf("NewChildPool: %v", err)
+		}
+		if err := child.Start(context.Background()); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		if err := child.Stop(); err != nil {
+			t.Fatalf("child Stop: %v", err)
+		}
+
+		if err := parent.Submit(1); err != nil {
+			t.Fatalf("parent Submit after the child stopped: %v", err)
+		}
+		if err := parent.Stop(); err != nil {
+			t.Fatalf("parent Stop: %v", err)
+		}
+		if r := sink.Results(); len(r) != 1 || r[0].Kind != KindInt {
+			t.Errorf("parent Results = %v, want the int processed", r)
+		}
+	})
+}
+
+func TestChildPoolParentNotStarted(t *testing.T) {
+	parent, err := NewWorkerPool(1)
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	child, err := NewChildPool(parent, 1)
+	if err != nil {
+		t.Fatalf("NewChildPool: %v", err)
+	}
+	if err := child.Start(context.Background()); !errors.Is(err, ErrPoolNotStarted) {
+		t.Errorf("Start = %v, want ErrPoolNotStarted", err)
+	}
+}
+
+func TestPoolSubmitWithTimeoutSaturated(t *testing.T) {
+	p := newStartedPool(t, 1)
+	release := holdWorkers(t, p, 1)
+	if err := p.Submit(0); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	start := time.Now()
+	if err := p.SubmitWithTimeout(1, 30*time.Millisecond); !errors.Is(err, ErrSubmitTimeout) {
+		t.Errorf("SubmitWithTimeout = %v, want ErrSubmitTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("gave up after %v, before the timeout", elapsed)
+	}
+
+	start = time.Now()
+	if err := p.SubmitWithTimeout(1, 0); !errors.Is(err, ErrSubmitTimeout) {
+		t.Errorf("SubmitWithTimeout(0) = %v, want ErrSubmitTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("a zero timeout waited %v", elapsed)
+	}
+
+	// Room freed before the timeout lets the item in.
+	time.AfterFunc(20*time.Millisecond, release)
+	if err := p.SubmitWithTimeout(1, time.Second); err != nil {
+		t.Errorf("SubmitWithTimeout once the worker was freed: %v", err)
+	}
+}
+
+func TestPoolResultsAfterDrain(t *testing.T) {
+	p := newStartedPool(t, 4)
+	results := p.Results()
+	if p.Results() != results {
+		t.Fatal("Results returned a different channel on the second call")
+	}
+
+	const n = 50
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := p.Submit(i); err != nil {
+				t.Errorf("Submit: %v", err)
+			}
+		}
+		if err := p.Shutdown(true); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+	}()
+
+	seen := make(map[interface{}]bool)
+	for r := range results {
+		seen[r.Input] = true
+	}
+	if len(seen) != n {
+		t.Errorf("%d distinct Results before the channel closed, want %d", len(seen), n)
+	}
+}
+
+func TestPoolResultsAfterStop(t *testing.T) {
+	p := newStartedPool(t, 1)
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	select {
+	case _, ok := <-p.Results():
+		if ok {
+			t.Error("received a Result from a stopped, idle pool")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Results not closed on a stopped pool")
+	}
+}
+
+func TestPoolPendingWhilePaused(t *testing.T) {
+	p := newStartedPool(t, 4)
+	p.Pause()
+	for _, item := range []interface{}{"a", 1, true} {
+		if err := p.Submit(item); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	if err := p.SubmitWithPriority("urgent", DefaultPriority+1); err != nil {
+		t.Fatalf("SubmitWithPriority: %v", err)
+	}
+
+	want := []interface{}{"urgent", "a", 1, true}
+	pending := p.Pending()
+	if !reflect.DeepEqual(pending, want) {
+		t.Errorf("Pending() = %v, want %v in the order workers take them", pending, want)
+	}
+	if got := p.PendingCount(); got != len(want) {
+		t.Errorf("PendingCount() = %d, want %d", got, len(want))
+	}
+
+	// The snapshot is a copy and reading it removes nothing.
+	pending[0] = "changed"
+	if got := p.Pending(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() = %v after changing a snapshot, want %v", got, want)
+	}
+
+	p.Resume()
+	p.Wait()
+	if got := p.PendingCount(); got != 0 || len(p.Pending()) != 0 {
+		t.Errorf("%d items still pending after Wait", got)
+	}
+}
+
+// workerFetcher records which worker fetched it, under its key.
+type workerFetcher struct {
+	key string
+	seq int
+	log *workerLog
+}
+
+type workerLog struct {
+	mu   sync.Mutex
+	seen map[string][]workerVisit
+}
+
+type workerVisit struct{ worker, seq int }
+
+func (f workerFetcher) Fetch(ctx context.Context) (string, error) {
+	id, ok := WorkerIDFromContext(ctx)
+	if !ok {
+		return "", errors.New("no worker ID in the context")
+	}
+	f.log.mu.Lock()
+	defer f.log.mu.Unlock()
+	f.log.seen[f.key] = append(f.log.seen[f.key], workerVisit{id, f.seq})
+	return "ok", nil
+}
+
+func TestPoolSubmitPartitionedAffinity(t *testing.T) {
+	p := newStartedPool(t, 4)
+	log := &workerLog{seen: make(map[string][]workerVisit)}
+	for i := 0; i < 20; i++ {
+		for _, key := range []string{"tenant-a", "tenant-b"} {
+			if err := p.SubmitPartitioned(key, workerFetcher{key, i, log}); err != nil {
+				t.Fatalf("SubmitPartitioned: %v", err)
+			}
+		}
+	}
+	p.Wait()
+
+	for _, key := range []string{"tenant-a", "tenant-b"} {
+		visits := log.seen[key]
+		if len(visits) != 20 {
+			t.Fatalf("%s: %d items handled, want 20", key, len(visits))
+		}
+		for i, v := range visits {
+			if v.worker != visits[0].worker {
+				t.Errorf("%s: item %d handled by worker %d, others by %d", key, v.seq, v.worker, visits[0].worker)
+			}
+			if v.seq != i {
+				t.Errorf("%s: item %d handled in position %d", key, v.seq, i)
+			}
+		}
+	}
+}
+
+func TestPoolSubmitPartitionedEmptyKeySpreads(t *testing.T) {
+	p := newStartedPool(t, 4)
+	release := holdWorkers(t, p, 4)
+	log := &workerLog{seen: make(map[string][]workerVisit)}
+	for i := 0; i < 4; i++ {
+		if err := p.SubmitPartitioned("", workerFetcher{"", i, log}); err != nil {
+			t.Fatalf("SubmitPartitioned: %v", err)
+		}
+	}
+	release()
+	p.Wait()
+
+	workers := make(map[int]bool)
+	for _, v := range log.seen[""] {
+		workers[v.worker] = true
+	}
+	if len(workers) != 4 {
+		t.Errorf("4 unkeyed items went to %d workers, want one each in turn", len(workers))
+	}
+}
+
+func TestPoolSubmitPartitionedResizeRehashes(t *testing.T) {
+	p := newStartedPool(t, 4)
+	p.Pause()
+	log := &workerLog{seen: make(map[string][]workerVisit)}
+	for i, key := range []string{"a", "b", "c", "d"} {
+		if err := p.SubmitPartitioned(key, workerFetcher{key, i, log}); err != nil {
+			t.Fatalf("SubmitPartitioned: %v", err)
+		}
+	}
+	p.Resize(2)
+	p.Resume()
+	p.Wait()
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		visits := log.seen[key]
+		if len(visits) != 1 || visits[0].worker >= 2 {
+			t.Errorf("%s: visits %v, want one by a worker left after the shrink", key, visits)
+		}
+	}
+}
+
+func TestPoolItemCancelLeavesPoolRunning(t *testing.T) {
+	sink := new(recordingSink)
+	p := newStartedPool(t, 2, WithSink(sink))
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	if err := p.SubmitWithID("slow", heldFetcher{started, release}); err != nil {
+		t.Fatalf("SubmitWithID: %v", err)
+	}
+	<-started
+
+	p.CancelItem("slow")
+	waitFor(t, func() bool { return len(sink.Results()) == 1 })
+	if !p.Health().Running {
+		t.Fatal("cancelling one item stopped the pool")
+	}
+
+	// The pool goes on, and without WithItemTimeout its items' work
+	// contexts carry no deadline of their own.
+	if err := p.Submit(tenantFetcher{}); err != nil {
+		t.Fatalf("Submit after CancelItem: %v", err)
+	}
+	p.Wait()
+	results := sink.Results()
+	if len(results) != 2 || results[1].Output != "Processed Fetch: tenant= deadline=false" {
+		t.Errorf("Results = %v, want the second item processed without a deadline", results)
+	}
+}
+
+func TestPoolShutdownContextCancelsEveryItem(t *testing.T) {
+	shutdown, cancel := context.WithCancel(context.Background())
+	sink := new(recordingSink)
+	p, err := NewWorkerPool(2, WithNoDelay(), WithLogger(nopLogger{}), WithSink(sink))
+	if err != nil {
+		t.Fatalf("NewWorkerPool: %v", err)
+	}
+	if err := p.Start(shutdown); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	holdWorkers(t, p, 2)
+
+	cancel()
+	waitFor(t, func() bool { return !p.Health().Running })
+	p.Wait()
+	results := sink.Results()
+	if len(results) != 2 {
+		t.Fatalf("got %d Results, want 2", len(results))
+	}
+	for _, r := range results {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("in-flight item finished with %v, want context.Canceled", r.Err)
+		}
+	}
+	if err := p.Submit(1); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Submit after shutdown: %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestPoolQueueWaitDelayedStart(t *testing.T) {
+	sink := new(recordingSink)
+	stats := new(Stats)
+	p := newStartedPool(t, 2, WithSink(sink), WithStats(stats))
+
+	// Pausing holds the workers back from the queue, so both items wait at
+	// least delay before one picks them up.
+	const delay = 30 * time.Millisecond
+	p.Pause()
+	if err := p.Submit("a"); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if err := p.SubmitWithID("b", "b"); err != nil {
+		t.Fatalf("SubmitWithID: %v", err)
+	}
+	time.Sleep(delay)
+	p.CancelItem("b")
+	p.Resume()
+	p.Wait()
+
+	results := sink.Results()
+	if len(results) != 2 {
+		t.Fatalf("got %d Results, want 2", len(results))
+	}
+	for _, r := range results {
+		if want := r.Input == "b"; (r.Kind == KindCancelled) != want {
+			t.Errorf("item %v finished as %s", r.Input, r.Kind)
+		}
+		if r.EnqueuedAt.IsZero() || r.QueueWait < delay {
+			t.Errorf("item %v (%s) QueueWait = %v, want at least %v", r.Input, r.Kind, r.QueueWait, delay)
+		}
+		if got := r.StartedAt.Sub(r.EnqueuedAt); got != r.QueueWait {
+			t.Errorf("item %v StartedAt-EnqueuedAt = %v, want QueueWait %v", r.Input, got, r.QueueWait)
+		}
+	}
+	if got := stats.AverageQueueWait(); got < delay {
+		t.Errorf("AverageQueueWait() = %v, want at least %v", got, delay)
+	}
+}
+
+// bufferedSink is a ResultSink holding its Results back until Flush, like
+// a sink writing through a bufio.Writer.
+type bufferedSink struct {
+	mu      sync.Mutex
+	pending []Result
+	visible []Result
+	flushes int
+	late    int // Results emitted after the first Flush
+	err     error
+}
+
+func (s *bufferedSink) Emit(r Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flushes > 0 {
+		s.late++
+	}
+	s.pending = append(s.pending, r)
+	return nil
+}
+
+func (s *bufferedSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	s.visible = append(s.visible, s.pending...)
+	s.pending = nil
+	return s.err
+}
+
+// Visible returns how many Results have been flushed.
+func (s *bufferedSink) Visible() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.visible)
+}
+
+func TestPoolShutdownFlushesSink(t *testing.T) {
+	for _, drain := range []bool{true, false} {
+		sink := new(bufferedSink)
+		p := newStartedPool(t, 2, WithSink(sink))
+		for i := 0; i < 2; i++ {
+			if err := p.Submit(i); err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+		}
+		p.Wait()
+		if got := sink.Visible(); got != 0 {
+			t.Fatalf("drain=%t: %d Results visible before Shutdown, want none", drain, got)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := p.Shutdown(drain); err != nil {
+				t.Fatalf("drain=%t: Shutdown: %v", drain, err)
+			}
+		}
+		sink.mu.Lock()
+		if len(sink.visible) != 2 || sink.flushes != 1 || sink.late != 0 {
+			t.Errorf("drain=%t: %d Results visible after %d flushes, %d emitted late; want 2 after exactly 1, none late",
+				drain, len(sink.visible), sink.flushes, sink.late)
+		}
+		sink.mu.Unlock()
+	}
+}
+
+func TestPoolShutdownFlushesInFlight(t *testing.T) {
+	sink := new(bufferedSink)
+	p := newStartedPool(t, 2, WithSink(sink))
+	holdWorkers(t, p, 2)
+
+	// The held items only finish, as cancelled, once Shutdown aborts them,
+	// so their Results must still be emitted before the sink is flushed.
+	if err := p.Shutdown(false); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.visible) != 2 || sink.late != 0 {
+		t.Errorf("%d Results visible, %d emitted after Flush; want 2 and none", len(sink.visible), sink.late)
+	}
+}
+
+func TestPoolShutdownReturnsFlushError(t *testing.T) {
+	errFlush := errors.New("disk full")
+	sink := &bufferedSink{err: errFlush}
+	p := newStartedPool(t, 1, WithSink(sink))
+	for i := 0; i < 2; i++ {
+		if err := p.Shutdown(true); err != errFlush {
+			t.Errorf("Shutdown #%d = %v, want %v", i+1, err, errFlush)
+		}
+	}
+	if sink.flushes != 1 {
+		t.Errorf("Flush called %d times, want 1", sink.flushes)
+	}
+}
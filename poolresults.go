@@ -0,0 +1,79 @@
+package main
+
+import "sync"
+
+// poolResults is the output side of a WorkerPool: an unbounded backlog of
+// Results forwarded, in completion order, to the channel returned by
+// Results. The backlog lets Shutdown(true) complete before anyone reads the
+// channel.
+type poolResults struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	out     chan Result // nil until Results is first called
+	pending []Result
+	done    bool // every worker has exited, so no Result is still to come
+}
+
+// Results returns the channel carrying the Result of every item that
+// finishes after the first call, which creates it; later calls return the
+// same channel. It is closed once the pool has stopped, whether by
+// Shutdown, Stop or its context, and every Result has been received, so
+// ranging over it terminates. Results that are not received pile up in
+// memory for as long as the pool runs.
+func (p *WorkerPool) Results() <-chan Result {
+	r := &p.results
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.out == nil {
+		r.cond = sync.NewCond(&r.mu)
+		r.out = make(chan Result)
+		go r.forward()
+	}
+	return r.out
+}
+
+// collect queues res for Results, if it has been called.
+func (r *poolResults) collect(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.out != nil {
+		r.pending = append(r.pending, res)
+		r.cond.Signal()
+	}
+}
+
+// finish records that no Result is still to come.
+func (r *poolResults) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.done = true
+	if r.cond != nil {
+		r.cond.Signal()
+	}
+}
+
+// forward sends the backlog on out and closes it once the pool has stopped
+// and the backlog is empty. It is the only sender on out and the only
+// place out is closed, so it can never be closed twice.
+func (r *poolResults) forward() {
+	for {
+		r.mu.Lock()
+		for len(r.pending) == 0 && !r.done {
+			r.cond.Wait()
+		}
+		if len(r.pending) == 0 {
+			r.mu.Unlock()
+			close(r.out)
+			return
+		}
+		res := r.pending[0]
+		r.pending[0] = Result{}
+		r.pending = r.pending[1:]
+		r.mu.Unlock()
+
+		r.out <- res
+	}
+}
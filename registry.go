@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+)
+
+// HandlerRegistry maps payload types to handlers that processData consults
+// before declaring a payload's type unknown. The built-in cases of the type
+// switch always take precedence.
+//
+// A HandlerRegistry is safe for concurrent use, but handlers are best
+// registered before workers start so every item sees the same set.
+type HandlerRegistry struct {
+	mu       sync.RWMutex
+	handlers map[reflect.Type]func(interface{}) string
+}
+
+// NewHandlerRegistry returns an empty HandlerRegistry.
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{handlers: make(map[reflect.Type]func(interface{}) string)}
+}
+
+// Register makes fn the handler for payloads with the same dynamic type as
+// sample, replacing any handler registered for it before. It panics if
+// sample or fn is nil.
+func (r *HandlerRegistry) Register(sample interface{}, fn func(interface{}) string) {
+	if sample == nil {
+		panic("goEngineer: Register called with a nil sample")
+	}
+	if fn == nil {
+		panic("goEngineer: Register called with a nil handler")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.handlers == nil {
+		r.handlers = make(map[reflect.Type]func(interface{}) string)
+	}
+	r.handlers[reflect.TypeOf(sample)] = fn
+}
+
+// lookup returns the handler registered for the dynamic type of data. It
+// is safe to call on a nil registry.
+func (r *HandlerRegistry) lookup(data interface{}) (func(interface{}) string, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fn, ok := r.handlers[reflect.TypeOf(data)]
+	return fn, ok
+}
+
+// WithRegistry makes processData consult r for payloads the type switch
+// does not handle.
+func WithRegistry(r *HandlerRegistry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// WithFallbackDecoder gives payloads of unsupported type one last chance:
+// when neither the type switch nor the registry handles a payload, fn is
+// called with it and, if it reports true, the value it returns goes through
+// the type switch instead, e.g. a json.RawMessage decoded into a known type.
+// The Result keeps the original payload as Input. A payload is decoded at
+// most once, so a decoded value of unsupported type is reported as unknown
+// rather than decoded again.
+func WithFallbackDecoder(fn func(interface{}) (interface{}, bool)) Option {
+	return func(o *options) {
+		o.fallback = fn
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+type Order struct {
+	ID    int
+	Total float64
+}
+
+func TestRegistryCustomType(t *testing.T) {
+	reg := NewHandlerRegistry()
+	reg.Register(Order{}, func(v interface{}) string {
+		o := v.(Order)
+		return fmt.Sprintf("Processed Order: #%d %.2f", o.ID, o.Total)
+	})
+
+	r := Classify(context.Background(), Order{ID: 7, Total: 9.5}, WithNoDelay(), WithRegistry(reg), WithLogger(nopLogger{}))
+	if r.Kind != KindCustom || r.Output != "Processed Order: #7 9.50" || r.Err != nil {
+		t.Fatalf("Result = (%s, %q, %v), want the Order handler's output", r.Kind, r.Output, r.Err)
+	}
+
+	// The lookup is by dynamic type, so *Order is still unknown.
+	r = Classify(context.Background(), &Order{}, WithNoDelay(), WithRegistry(reg), WithLogger(nopLogger{}))
+	if r.Kind != KindUnknown {
+		t.Fatalf("*Order: Kind %s, want unknown", r.Kind)
+	}
+}
+
+func TestRegistryBuiltinsTakePrecedence(t *testing.T) {
+	reg := NewHandlerRegistry()
+	reg.Register(0, func(interface{}) string { return "custom int" })
+
+	r := Classify(context.Background(), 42, WithNoDelay(), WithRegistry(reg), WithLogger(nopLogger{}))
+	if r.Kind != KindInt || r.Output != "Processed Int: 42" {
+		t.Fatalf("Result = (%s, %q), want the built-in int case", r.Kind, r.Output)
+	}
+}
+
+func TestRegistryRegisterNil(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Register(nil, fn) did not panic")
+		}
+	}()
+	NewHandlerRegistry().Register(nil, func(interface{}) string { return "" })
+}
+
+// wrapped is a payload the fallback decoder unwraps.
+type wrapped struct{ v interface{} }
+
+func TestFallbackDecoderUnwraps(t *testing.T) {
+	calls := 0
+	unwrap := func(v interface{}) (interface{}, bool) {
+		calls++
+		w, ok := v.(wrapped)
+		return w.v, ok
+	}
+	in := wrapped{42}
+	r := Classify(context.Background(), in, WithFallbackDecoder(unwrap), WithNoDelay(), WithLogger(nopLogger{}))
+	if r.Kind != KindInt || r.Output != "Processed Int: 42" || r.Input != in {
+		t.Errorf("Result = (%s, %q, input %v), want the int processed with the wrapper as Input", r.Kind, r.Output, r.Input)
+	}
+	if calls != 1 {
+		t.Errorf("decoder called %d times, want 1", calls)
+	}
+}
+
+func TestFallbackDecoderRunsOnce(t *testing.T) {
+	// A decoder that always wraps once more would loop without the guard.
+	calls := 0
+	rewrap := func(v interface{}) (interface{}, bool) {
+		calls++
+		return wrapped{v}, true
+	}
+	r := Classify(context.Background(), wrapped{1}, WithFallbackDecoder(rewrap), WithNoDelay(), WithLogger(nopLogger{}))
+	if r.Kind != KindUnknown || calls != 1 {
+		t.Errorf("Result = %s after %d decoder calls, want unknown after 1", r.Kind, calls)
+	}
+}
+
+func TestFallbackDecoderDeclines(t *testing.T) {
+	decline := func(interface{}) (interface{}, bool) { return 42, false }
+	r := Classify(context.Background(), wrapped{1}, WithFallbackDecoder(decline), WithNoDelay(), WithLogger(nopLogger{}))
+	if r.Kind != KindUnknown {
+		t.Errorf("Kind = %s, want unknown when the decoder declines", r.Kind)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// DefaultMaxRequeueDepth is how many generations of items Requeue allows
+// below an item submitted to a WorkerPool, unless WithMaxRequeueDepth says
+// otherwise.
+const DefaultMaxRequeueDepth = 8
+
+// ErrNotInPool is returned by Requeue when ctx is not the context of an item
+// processed by a WorkerPool.
+var ErrNotInPool = errors.New("not processing a worker pool item")
+
+// ErrRequeueDepth is returned by Requeue when the new item would be nested
+// deeper than WithMaxRequeueDepth allows.
+var ErrRequeueDepth = errors.New("requeue depth exceeded")
+
+// requeueTarget is the pool, and the depth within it, of the item being
+// processed, as carried by its context.
+type requeueTarget struct {
+	pool  *WorkerPool
+	depth int // 0 for a submitted item, 1 for its children, and so on
+}
+
+// WithMaxRequeueDepth sets how many generations of items Requeue allows
+// below a submitted item: with n of 1, a submitted item may requeue
+// children, but those may not requeue any further. Zero keeps
+// DefaultMaxRequeueDepth and a negative n is invalid.
+func WithMaxRequeueDepth(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			o.reject("WithMaxRequeueDepth", n, "negative depth")
+			return
+		}
+		o.requeueDepth = n
+	}
+}
+
+// maxRequeueDepth returns the WithMaxRequeueDepth limit.
+func (o *options) maxRequeueDepth() int {
+	if o.requeueDepth <= 0 {
+		return DefaultMaxRequeueDepth
+	}
+	return o.requeueDepth
+}
+
+// Requeue submits data to the WorkerPool processing the item whose context
+// is ctx, such as the context a Middleware is handed, as a child of that
+// item. The child is counted by WorkerPool.Wait before Requeue returns, so
+// Wait cannot return between the parent finishing and the child being
+// processed. Requeue never blocks: a child may overfill the queue, so that
+// a worker requeueing into a full pool cannot deadlock it. It returns
+// ErrNotInPool if ctx is not a pool item's context, ErrRequeueDepth past
+// WithMaxRequeueDepth, and ErrPoolClosed once the pool has been shut down.
+func Requeue(ctx context.Context, data interface{}) error {
+	t, ok := ctx.Value(requeueKey).(requeueTarget)
+	if !ok {
+		return ErrNotInPool
+	}
+	return t.pool.requeue(data, t.depth+1)
+}
+
+// requeue enqueues data as an item at depth, bypassing the queue capacity.
+func (p *WorkerPool) requeue(data interface{}, depth int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.closed:
+		return ErrPoolClosed
+	case depth > p.o.maxRequeueDepth():
+		return ErrRequeueDepth
+	}
+
+	p.push(job{data: data, priority: DefaultPriority, depth: depth})
+	return nil
+}
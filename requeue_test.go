@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// countdown returns a Middleware requeueing n-1 for every int n above zero,
+// recording each Requeue error in *errs.
+func countdown(mu *sync.Mutex, errs *[]error) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, data interface{}) Result {
+			if n, ok := data.(int); ok && n > 0 {
+				err := Requeue(ctx, n-1)
+				mu.Lock()
+				*errs = append(*errs, err)
+				mu.Unlock()
+			}
+			return next(ctx, data)
+		}
+	}
+}
+
+// inputs returns the Inputs of results, sorted.
+func inputs(results []Result) []int {
+	var in []int
+	for _, r := range results {
+		in = append(in, r.Input.(int))
+	}
+	slices.Sort(in)
+	return in
+}
+
+func TestRequeueChildBeforeWait(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	sink := new(recordingSink)
+	p := newStartedPool(t, 2, WithSink(sink), WithMiddleware(countdown(&mu, &errs)))
+
+	if err := p.Submit(1); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	p.Wait()
+
+	if got := inputs(sink.Results()); !slices.Equal(got, []int{0, 1}) {
+		t.Fatalf("processed %v before Wait returned, want the parent 1 and its child 0", got)
+	}
+	if len(errs) != 1 || errs[0] != nil {
+		t.Errorf("Requeue errors = %v, want one nil", errs)
+	}
+}
+
+func TestRequeueMaxDepth(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	sink := new(recordingSink)
+	p := newStartedPool(t, 1, WithSink(sink), WithMaxRequeueDepth(2), WithMiddleware(countdown(&mu, &errs)))
+
+	if err := p.Submit(5); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	p.Wait()
+
+	// 5 is at depth 0, 4 at 1 and 3 at 2, the deepest allowed.
+	if got := inputs(sink.Results()); !slices.Equal(got, []int{3, 4, 5}) {
+		t.Fatalf("processed %v, want 3, 4 and 5", got)
+	}
+	if len(errs) != 3 || errs[0] != nil || errs[1] != nil || !errors.Is(errs[2], ErrRequeueDepth) {
+		t.Errorf("Requeue errors = %v, want nil, nil, ErrRequeueDepth", errs)
+	}
+}
+
+func TestRequeueOutsidePool(t *testing.T) {
+	if err := Requeue(context.Background(), 1); !errors.Is(err, ErrNotInPool) {
+		t.Errorf("Requeue = %v, want ErrNotInPool", err)
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	processData(context.Background(), nil, 1, nil, WithNoDelay(), WithLogger(nopLogger{}), WithMiddleware(countdown(&mu, &errs)))
+	if len(errs) != 1 || !errors.Is(errs[0], ErrNotInPool) {
+		t.Errorf("Requeue from processData = %v, want ErrNotInPool", errs)
+	}
+}
+
+func TestRequeueAfterShutdown(t *testing.T) {
+	release := make(chan struct{})
+	errc := make(chan error, 1)
+	wait := func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, data interface{}) Result {
+			<-release
+			errc <- Requeue(ctx, "child")
+			return next(ctx, data)
+		}
+	}
+	p := newStartedPool(t, 1, WithMiddleware(wait))
+	if err := p.Submit("parent"); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	// Shutdown closes the pool, then waits for the held parent to finish.
+	done := make(chan error, 1)
+	go func() { done <- p.Shutdown(true) }()
+	waitFor(t, func() bool { return errors.Is(p.Submit(0), ErrPoolClosed) })
+	close(release)
+
+	if err := <-errc; !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Requeue after Shutdown = %v, want ErrPoolClosed", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
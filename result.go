@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Result describes the outcome of processing a single payload.
+type Result struct {
+	Input  interface{}
+	Output string
+	Kind   Kind // one of the Kind constants, such as KindString or KindCancelled
+	Err    error
+	Length int // length of a string or []byte payload, zero for every other type
+
+	// RuneLength is the utf8.RuneCount of a []byte payload. Each byte of an
+	// invalid UTF-8 sequence counts as one rune.
+	RuneLength int
+
+	Attempts int // number of Fetch attempts made for a Fetcher payload
+
+	CorrelationID string // request-scoped ID from WithCorrelationID, if any
+	ID            string // item ID given by Run and Dispatch, see WithIDGenerator
+
+	// A copy of the Envelope's Meta, set by ProcessEnvelope only.
+	Meta map[string]string
+
+	// When the item was queued, by a WorkerPool or in the Envelope given to
+	// ProcessEnvelope, when processing started and when it finished, or was
+	// cancelled. QueueWait is the time from EnqueuedAt to StartedAt, zero
+	// when EnqueuedAt is not known. ProcessTime is how long processing took,
+	// whatever its outcome. Cancelled items report all of them.
+	EnqueuedAt  time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	QueueWait   time.Duration
+	ProcessTime time.Duration
+
+	ReflectKind reflect.Kind // reflect kind of the payload, only set on Kind "unknown"
+
+	// For items whose processing panicked: the stack of the panicking
+	// goroutine, and, if the item's context was already done by then, so it
+	// is reported as cancelled rather than Kind "panic", the recovered panic.
+	Stack []byte
+	Panic *PanicError
+
+	// For cancelled items: how long after the context's deadline the
+	// cancellation was observed (zero without a deadline), and
+	// context.Cause(ctx): context.DeadlineExceeded after a timeout,
+	// context.Canceled after a plain cancel, or the cause passed to a
+	// context.CancelCauseFunc such as the one from RunCancellable.
+	DeadlineExceededBy time.Duration
+	CancelCause        error
+}
+
+// maxInputWidth is how many runes of the Input Result.String renders before
+// truncating it.
+const maxInputWidth = 32
+
+// String renders r as one compact line: the Input's type and value, then its
+// Output on success, or its Kind and error on failure, e.g.
+// "int=42 -> Processed Int: 42" or
+// "string=Alpha -> cancelled (context deadline exceeded)". Long inputs, such
+// as large []byte payloads, are truncated.
+func (r Result) String() string {
+	input := []rune(fmt.Sprintf("%v", r.Input))
+	if len(input) > maxInputWidth {
+		input = append(input[:maxInputWidth], []rune("...")...)
+	}
+	head := fmt.Sprintf("%T=%s", r.Input, string(input))
+	if r.Input == nil {
+		head = "nil"
+	}
+
+	switch {
+	case r.Err == nil:
+		return fmt.Sprintf("%s -> %s", head, r.Output)
+	case r.CancelCause != nil:
+		return fmt.Sprintf("%s -> %s (%v)", head, r.Kind, r.CancelCause)
+	default:
+		return fmt.Sprintf("%s -> %s (%v)", head, r.Kind, r.Err)
+	}
+}
+
+// markCancelled records that r.Input was not processed because ctx was done
+// first, as observed at now by a worker that started at start. The Output
+// tells a deadline that fired ("timed out") from an explicit cancel
+// ("cancelled"). Reading the cause is safe here: once Done is closed it is
+// guaranteed to be non-nil and never changes again.
+func (r *Result) markCancelled(ctx context.Context, start, now time.Time) {
+	reason := "cancelled"
+	if errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		reason = "timed out"
+	}
+
+	r.Kind = KindCancelled
+	r.Output = fmt.Sprintf("Context %s for data: %v after %v", reason, r.Input, now.Sub(start).Round(time.Millisecond))
+	r.CancelCause = context.Cause(ctx)
+	r.Err = &CancelledError{Cause: r.CancelCause}
+	if deadline, ok := ctx.Deadline(); ok && now.After(deadline) {
+		r.DeadlineExceededBy = now.Sub(deadline)
+	}
+}
+
+// AggregateResults groups results by Kind, keeping their relative order
+// within each group. It always returns a non-nil map.
+func AggregateResults(results []Result) map[Kind][]Result {
+	groups := make(map[Kind][]Result)
+	for _, r := range results {
+		groups[r.Kind] = append(groups[r.Kind], r)
+	}
+	return groups
+}
+
+// SortByFinish sorts results by FinishedAt, earliest first, for a timeline
+// of the batch. The sort is stable, so Results that finished at the same
+// instant keep their relative order. Only the slice is reordered; the
+// Results themselves are left untouched.
+func SortByFinish(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].FinishedAt.Before(results[j].FinishedAt)
+	})
+}
+
+// Counts reports how many results there are of each Kind. It always returns
+// a non-nil map.
+func Counts(results []Result) map[Kind]int {
+	counts := make(map[Kind]int)
+	for _, r := range results {
+		counts[r.Kind]++
+	}
+	return counts
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAggregateResults(t *testing.T) {
+	results := []Result{
+		{Input: "a", Kind: KindString},
+		{Input: 1, Kind: KindInt},
+		{Input: "b", Kind: KindString},
+		{Input: struct{}{}, Kind: KindUnknown},
+		{Input: 2, Kind: KindCancelled},
+	}
+
+	groups := AggregateResults(results)
+	if got := groups[KindString]; len(got) != 2 || got[0].Input != "a" || got[1].Input != "b" {
+		t.Fatalf("string bucket = %v, want a then b", got)
+	}
+	if len(groups[KindInt]) != 1 || len(groups[KindUnknown]) != 1 || len(groups[KindCancelled]) != 1 {
+		t.Fatalf("groups = %v", groups)
+	}
+
+	want := map[Kind]int{KindString: 2, KindInt: 1, KindUnknown: 1, KindCancelled: 1}
+	if got := Counts(results); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Counts = %v, want %v", got, want)
+	}
+}
+
+func TestAggregateResultsEmpty(t *testing.T) {
+	if g := AggregateResults(nil); g == nil || len(g) != 0 {
+		t.Fatalf("AggregateResults(nil) = %v, want an empty, non-nil map", g)
+	}
+	if c := Counts(nil); c == nil || len(c) != 0 {
+		t.Fatalf("Counts(nil) = %v, want an empty, non-nil map", c)
+	}
+}
+
+func TestResultString(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	quiet := []Option{WithNoDelay(), WithLogger(nopLogger{})}
+
+	tests := []struct {
+		name string
+		r    Result
+		want string
+	}{
+		{"success", Classify(context.Background(), 42, quiet...), "int=42 -> Processed Int: 42"},
+		{"cancelled", Classify(expired, "Alpha", quiet...), "string=Alpha -> cancelled (context deadline exceeded)"},
+		{"unknown", Classify(context.Background(), Order{ID: 7}, quiet...), "main.Order={7 0} -> unknown (unsupported type: main.Order)"},
+		{"nil", Classify(context.Background(), nil, quiet...), "nil -> Received nil payload"},
+		{"truncated", Result{Input: strings.Repeat("x", 40), Output: "ok"}, "string=" + strings.Repeat("x", 32) + "... -> ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortByFinishCompletionOrder(t *testing.T) {
+	// Item 4 never finishes its work and is cancelled after the others
+	// completed.
+	work := []time.Duration{60 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Millisecond)
+	defer cancel()
+
+	results := make([]Result, len(work))
+	var wg sync.WaitGroup
+	for i, d := range work {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = Classify(WithProcessOptions(ctx, ProcessOptions{WorkDuration: d}), i+1, WithLogger(nopLogger{}))
+		}()
+	}
+	wg.Wait()
+	before := slices.Clone(results)
+
+	SortByFinish(results)
+	if got, want := inputsOf(results), []interface{}{2, 3, 1, 4}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("sorted Inputs = %v, want %v", got, want)
+	}
+	for _, r := range results {
+		if !reflect.DeepEqual(r, before[r.Input.(int)-1]) {
+			t.Errorf("SortByFinish changed the Result of %v", r.Input)
+		}
+	}
+	if last := results[3]; last.Kind != KindCancelled || last.FinishedAt.IsZero() {
+		t.Errorf("cancelled item = (%s, FinishedAt %v), want its cancellation time", last.Kind, last.FinishedAt)
+	}
+}
+
+func TestSortByFinishStable(t *testing.T) {
+	t0 := time.Unix(1_000_000, 0)
+	results := []Result{
+		{Input: "b", FinishedAt: t0.Add(time.Second)},
+		{Input: "a1", FinishedAt: t0},
+		{Input: "a2", FinishedAt: t0},
+		{Input: "a3", FinishedAt: t0},
+	}
+	SortByFinish(results)
+	want := []interface{}{"a1", "a2", "a3", "b"}
+	if got := inputsOf(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted Inputs = %v, want %v", got, want)
+	}
+}
+
+// inputsOf returns the Inputs of results, in order.
+func inputsOf(results []Result) []interface{} {
+	in := make([]interface{}, len(results))
+	for i, r := range results {
+		in[i] = r.Input
+	}
+	return in
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRetryable marks a processing error as transient. processData retries
+// attempts failing with an error that wraps it when WithRetry is set.
+var ErrRetryable = errors.New("retryable")
+
+// Retryable wraps err so that it matches ErrRetryable.
+func Retryable(err error) error {
+	return fmt.Errorf("%w: %w", ErrRetryable, err)
+}
+
+// Fetcher is implemented by payloads whose processing is a remote call that
+// may fail transiently. processData calls Fetch after the simulated work and
+// retries it as configured by WithRetry.
+type Fetcher interface {
+	Fetch(ctx context.Context) (string, error)
+}
+
+// WithRetry makes processData re-attempt a Fetch failing with ErrRetryable
+// up to max more times, waiting backoff between attempts. A negative max or
+// backoff is invalid.
+func WithRetry(max int, backoff time.Duration) Option {
+	return func(o *options) {
+		switch {
+		case max < 0:
+			o.reject("WithRetry", max, "negative retry count")
+			return
+		case backoff < 0:
+			o.reject("WithRetry", backoff, "negative backoff")
+			return
+		}
+		o.maxRetries = max
+		o.backoff = backoff
+	}
+}
+
+// retry calls fetch until it succeeds, fails with a non-retryable error or
+// the retries configured by WithRetry are used up, and reports how many
+// attempts were made. It returns ErrContextCancelled if ctx is done between
+// attempts, and gives up with the last error rather than waiting out a
+// backoff that would end past ctx's deadline.
+func (o *options) retry(ctx context.Context, fetch func(context.Context) (string, error)) (string, int, error) {
+	for attempt := 1; ; attempt++ {
+		out, err := fetch(ctx)
+		if err == nil || !errors.Is(err, ErrRetryable) || attempt > o.maxRetries {
+			return out, attempt, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && deadline.Sub(o.clk().Now()) < o.backoff {
+			return out, attempt, err
+		}
+
+		if o.sleep(ctx, o.backoff) != nil {
+			return "", attempt, ErrContextCancelled
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyFetcher fails with a retryable error until it has been called
+// failures times.
+type flakyFetcher struct {
+	failures int32
+	calls    *int32
+}
+
+func (f flakyFetcher) Fetch(context.Context) (string, error) {
+	if atomic.AddInt32(f.calls, 1) <= f.failures {
+		return "", Retryable(errors.New("flaky"))
+	}
+	return "ok", nil
+}
+
+func TestRetrySucceedsOnThirdAttempt(t *testing.T) {
+	var calls int32
+	r := Classify(context.Background(), flakyFetcher{failures: 2, calls: &calls},
+		WithNoDelay(), WithRetry(3, time.Millisecond), WithLogger(nopLogger{}))
+	if r.Kind != KindFetched || r.Attempts != 3 || r.Output != "Processed Fetch: ok" {
+		t.Fatalf("Result = %s after %d attempts (%q), want fetched on the third", r.Kind, r.Attempts, r.Output)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	var calls int32
+	r := Classify(context.Background(), flakyFetcher{failures: 5, calls: &calls},
+		WithNoDelay(), WithRetry(2, time.Millisecond), WithLogger(nopLogger{}))
+	if r.Kind != KindFailed || r.Attempts != 3 || !errors.Is(r.Err, ErrRetryable) {
+		t.Fatalf("Result = %s after %d attempts (%v), want failed after 3", r.Kind, r.Attempts, r.Err)
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var calls int32
+	start := time.Now()
+	r := Classify(ctx, flakyFetcher{failures: 5, calls: &calls},
+		WithNoDelay(), WithRetry(5, time.Hour), WithLogger(nopLogger{}))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("retry slept %v past the deadline", elapsed)
+	}
+	if r.Attempts != 1 || !errors.Is(r.Err, ErrRetryable) {
+		t.Fatalf("Result = %d attempts (%v), want one attempt and its error", r.Attempts, r.Err)
+	}
+}
+
+func TestRetryNonRetryableError(t *testing.T) {
+	calls := 0
+	o := newOptions([]Option{WithRetry(3, time.Millisecond)})
+	_, attempts, err := o.retry(context.Background(), func(context.Context) (string, error) {
+		calls++
+		return "", errors.New("permanent")
+	})
+	if err == nil || attempts != 1 || calls != 1 {
+		t.Fatalf("retry = (%d attempts, %v), want one attempt", attempts, err)
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RunGroup processes every item concurrently under a shared context and
+// returns the first error encountered, cancelling the remaining items as soon
+// as it happens, in the spirit of golang.org/x/sync/errgroup. The returned
+// error wraps the processData error and names the offending item. Invalid
+// options are reported, as Validate does, before any item is dispatched.
+func RunGroup(ctx context.Context, items []interface{}, opts ...Option) error {
+	if err := Validate(opts...); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The channel has room for every Result, so no worker ever blocks on it
+	// and each Result is delivered before its worker signals wg.
+	results := make(chan Result, len(items))
+	firstErr := make(chan error, 1)
+
+	go func() {
+		var first error
+		for r := range results {
+			if r.Err != nil && first == nil {
+				first = fmt.Errorf("item %v: %w", r.Input, r.Err)
+				cancel()
+			}
+		}
+		firstErr <- first
+	}()
+
+	dispatch(ctx, items, results, opts).Wait()
+	close(results)
+	err := <-firstErr
+	newOptions(opts).repanic()
+	return err
+}
+
+// ProcessAllFailFast processes items concurrently, like RunGroup, but stops
+// on timeouts rather than errors: the first item cancelled by ctx's deadline,
+// or by its own WithItemTimeout, cancels every item still in flight.
+// Unsupported or failed items do not stop the batch. It returns once every
+// item has finished, which is prompt after a timeout, with the Results in
+// completion order: those completed before the timeout, the timed-out item,
+// and its siblings reported as cancelled. firstTimeout reports whether the
+// batch was cut short by a timeout; items cancelled by cancelling ctx itself
+// do not count as timed out. Under invalid options every Result is
+// rejected with the *OptionError values, as in processData.
+func ProcessAllFailFast(ctx context.Context, items []interface{}, opts ...Option) (results []Result, firstTimeout bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Room for every Result, as in RunGroup, so no worker blocks on the
+	// channel.
+	ch := make(chan Result, len(items))
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for r := range ch {
+			results = append(results, r)
+			if r.Kind == KindCancelled && errors.Is(r.CancelCause, context.DeadlineExceeded) && !firstTimeout {
+				firstTimeout = true
+				cancel()
+			}
+		}
+	}()
+
+	dispatch(ctx, items, ch, opts).Wait()
+	close(ch)
+	<-done
+	newOptions(opts).repanic()
+	return results, firstTimeout
+}
+
+// RunCancellable starts processing items in the background, under the
+// deadline set by WithTimeout (200ms by default), and returns straight away.
+// Calling cancel stops the batch early with a cause that every item
+// cancelled by it records in its Result's CancelCause; items cut short by
+// the deadline record context.DeadlineExceeded instead. results blocks until
+// every item has finished and returns their Results in completion order.
+// Under invalid options every Result is rejected with the *OptionError
+// values, as in processData.
+func RunCancellable(items []interface{}, opts ...Option) (results func() []Result, cancel context.CancelCauseFunc) {
+	o := newOptions(opts)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	ctx, stop := withTimeout(ctx, o.runTimeout(), o.clk())
+
+	ch := make(chan Result, len(items))
+	var collected []Result
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatch(ctx, items, ch, opts).Wait()
+		stop()
+		close(ch)
+		for r := range ch {
+			collected = append(collected, r)
+		}
+	}()
+
+	return func() []Result {
+		<-done
+		o.repanic()
+		return collected
+	}, cancel
+}
+
+// ProcessBatch processes items concurrently and returns their Results in the
+// same order as items. It prints nothing unless a Logger is supplied through
+// opts. An empty batch yields an empty, non-nil slice and a nil ctx is
+// treated as context.Background(). Under invalid options every Result is
+// rejected with the *OptionError values, as in processData.
+func ProcessBatch(ctx context.Context, items []interface{}, opts ...Option) []Result {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	o := newOptions(append([]Option{WithLogger(nopLogger{})}, opts...))
+	results := make([]Result, len(items))
+
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item interface{}) {
+			defer wg.Done()
+			results[i] = classify(ctx, item, o)
+		}(i, item)
+	}
+
+	wg.Wait()
+	o.repanic()
+	return results
+}
+
+// ProcessMap processes every value of m concurrently and returns the Results
+// keyed like m. Like ProcessBatch it prints nothing unless a Logger is
+// supplied through opts, treats a nil ctx as context.Background() and
+// rejects every value under invalid options.
+func ProcessMap(ctx context.Context, m map[string]interface{}, opts ...Option) map[string]Result {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	o := newOptions(append([]Option{WithLogger(nopLogger{})}, opts...))
+	results := make(map[string]Result, len(m))
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for key, value := range m {
+		wg.Add(1)
+		go func(key string, value interface{}) {
+			defer wg.Done()
+			r := classify(ctx, value, o)
+
+			mu.Lock()
+			results[key] = r
+			mu.Unlock()
+		}(key, value)
+	}
+
+	wg.Wait()
+	o.repanic()
+	return results
+}
+
+// Dispatch launches one processData goroutine per item and returns the
+// WaitGroup tracking them, leaving it to the caller to decide when to Wait.
+// With WithRateLimit, Dispatch paces the launches and only returns once the
+// last item has been launched or ctx is cancelled, in which case the items
+// not yet launched are never dispatched.
+//
+// Add is always called on the dispatching goroutine, immediately before the
+// corresponding go statement and never inside the launched goroutine, so the
+// counter can never reach zero while items are still being dispatched and a
+// concurrent Wait cannot return early.
+func Dispatch(ctx context.Context, items []interface{}, opts ...Option) *sync.WaitGroup {
+	return dispatch(ctx, items, nil, opts)
+}
+
+// WaitCtx waits for wg like wg.Wait, but returns ctx.Err() as soon as ctx is
+// done, even if a worker hangs. It returns nil once the group completes. The
+// goroutine waiting on wg outlives an early return only until the group
+// eventually completes.
+func WaitCtx(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// Report completion if the group finished at the same moment.
+		select {
+		case <-done:
+			return nil
+		default:
+			return ctx.Err()
+		}
+	}
+}
+
+// dispatch is Dispatch with an optional results channel for the workers.
+func dispatch(ctx context.Context, items []interface{}, results chan<- Result, opts []Option) *sync.WaitGroup {
+	o := newOptions(opts)
+	items = o.sorted(items)
+
+	var ordered *orderedOutput
+	if o.ordered {
+		ordered = newOrderedOutput(o.log(), len(items))
+	}
+
+	wg := new(sync.WaitGroup)
+	launched := 0
+	for i, item := range items {
+		// Filter before anything is spent on the item, even a token.
+		if o.filteredOut(item) {
+			o.reportFiltered(ctx, item, results)
+			if ordered != nil {
+				ordered.finish(i)
+			}
+			continue
+		}
+
+		if launched > 0 && !o.waitForToken(ctx) {
+			break
+		}
+		launched++
+
+		itemOpts := opts
+		if ordered != nil {
+			itemOpts = append(opts[:len(opts):len(opts)], ordered.option(i))
+		}
+
+		itemCtx := context.WithValue(o.withItemIndex(ctx, i), itemIDKey, o.newID())
+		o.record(itemCtx, "enqueued")
+
+		wg.Add(1)
+		if o.synchronous {
+			processData(itemCtx, wg, item, results, itemOpts...)
+			continue
+		}
+		go processData(itemCtx, wg, item, results, itemOpts...)
+	}
+	return wg
+}
+
+// WithSynchronous makes Run, Dispatch and the other dispatching helpers
+// process the items one after the other on the calling goroutine instead of
+// launching a goroutine per item, so output order is deterministic and
+// stack traces lead back to the caller. Each item is processed exactly as
+// it would be concurrently, under the same context and timeouts; the
+// WaitGroup is still signalled, but has completed by the time Dispatch
+// returns. It suits debugging and tests, not throughput.
+func WithSynchronous() Option {
+	return func(o *options) {
+		o.synchronous = true
+	}
+}
+
+// WithSort makes Run and Dispatch launch the items in the order defined by
+// less instead of the order they were given in. It only fixes the dispatch
+// order; the items still run, and complete, concurrently. less sees the raw
+// payloads, so comparing mixed types is entirely up to it. A nil less keeps
+// the given order.
+func WithSort(less func(a, b interface{}) bool) Option {
+	return func(o *options) {
+		o.less = less
+	}
+}
+
+// sorted returns items in dispatch order. The caller's slice is never
+// reordered.
+func (o *options) sorted(items []interface{}) []interface{} {
+	if o.less == nil {
+		return items
+	}
+
+	sorted := append([]interface{}(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return o.less(sorted[i], sorted[j]) })
+	return sorted
+}
+
+// itemIDs numbers the items given IDs by the default generator. It is shared
+// by every call, so no two items of a process ever get the same default ID.
+var itemIDs uint64
+
+// WithIDGenerator makes Run and Dispatch label each item with an ID from
+// fn, carried by the item's context (see ItemIDFromContext) and recorded in
+// its Result. fn is only called from the dispatching goroutine, but calls
+// on behalf of concurrent batches may overlap, so it must be safe for
+// concurrent use. By default IDs are "item-1", "item-2", and so on, from a
+// process-wide counter.
+func WithIDGenerator(fn func() string) Option {
+	return func(o *options) {
+		o.newIDFunc = fn
+	}
+}
+
+// newID returns the ID of the next dispatched item.
+func (o *options) newID() string {
+	if o.newIDFunc != nil {
+		return o.newIDFunc()
+	}
+	return fmt.Sprintf("item-%d", atomic.AddUint64(&itemIDs, 1))
+}
+
+// WithRateLimit makes Run and Dispatch launch at most perSecond items per
+// second, spacing the launches evenly. Rate limiting is off by default; a
+// perSecond of zero or less is invalid.
+func WithRateLimit(perSecond int) Option {
+	return func(o *options) {
+		if perSecond <= 0 {
+			o.reject("WithRateLimit", perSecond, "rate must be positive")
+			return
+		}
+		o.rateLimit = perSecond
+	}
+}
+
+// waitForToken blocks until the rate limiter allows the next launch. It
+// returns false if ctx is cancelled first.
+func (o *options) waitForToken(ctx context.Context) bool {
+	if o.rateLimit <= 0 {
+		return true
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-o.clk().After(time.Second / time.Duration(o.rateLimit)):
+		return true
+	}
+}
+
+// ProcessOne processes a single item through processData on its own
+// goroutine and blocks until its Result is ready, for request/response
+// callers that want neither channels nor WaitGroups. ctx's deadline and
+// cancellation apply as usual, yielding a cancelled Result. The Result is
+// returned even if it failed and WithDeadLetter is set.
+func ProcessOne(ctx context.Context, data interface{}, opts ...Option) Result {
+	var wg sync.WaitGroup
+	results := make(chan Result, 1)
+
+	wg.Add(1)
+	go processData(ctx, &wg, data, results, append(opts[:len(opts):len(opts)], WithDeadLetter(nil))...)
+	wg.Wait()
+	return <-results
+}
+
+// ProcessWithDone is processData for callers holding a plain done channel
+// instead of a context. Closing done cancels the item just like a cancelled
+// context would; a nil done never cancels, so only the simulated work
+// duration bounds the call. It signals wg and returns the item's Result.
+func ProcessWithDone(done <-chan struct{}, wg *sync.WaitGroup, data interface{}, opts ...Option) Result {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if done != nil {
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	results := make(chan Result, 1)
+	processData(ctx, wg, data, results, append(opts[:len(opts):len(opts)], WithDeadLetter(nil))...)
+	return <-results
+}
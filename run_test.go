@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessBatchKeepsOrderNoLeak(t *testing.T) {
+	items := []interface{}{"a", 1, 2.5, true, []byte("b")}
+	AssertNoGoroutineLeak(t, func() {
+		results := ProcessBatch(context.Background(), items, WithNoDelay())
+		for i, r := range results {
+			if fmt.Sprint(r.Input) != fmt.Sprint(items[i]) {
+				t.Errorf("results[%d].Input = %v, want %v", i, r.Input, items[i])
+			}
+		}
+	})
+}
+
+func TestProcessBatchCancelledNoLeak(t *testing.T) {
+	AssertNoGoroutineLeak(t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+		results := ProcessBatch(ctx, []interface{}{1, 2, 3}, WithWorkDuration(time.Hour))
+		for _, r := range results {
+			if r.Kind != KindCancelled {
+				t.Errorf("Kind = %v, want %v", r.Kind, KindCancelled)
+			}
+		}
+	})
+}
+
+func TestProcessBatchEmpty(t *testing.T) {
+	results := ProcessBatch(nil, nil)
+	if results == nil || len(results) != 0 {
+		t.Fatalf("ProcessBatch(nil, nil) = %v, want an empty, non-nil slice", results)
+	}
+}
+
+// blockingFetcher is a payload whose Fetch blocks until its context is
+// done.
+type blockingFetcher struct{}
+
+func (blockingFetcher) Fetch(ctx context.Context) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestRunGroupCancelsOnFirstError(t *testing.T) {
+	items := []interface{}{blockingFetcher{}, blockingFetcher{}, map[string]int{}, blockingFetcher{}}
+	sink := new(recordingSink)
+
+	err := RunGroup(context.Background(), items, WithNoDelay(), WithLogger(nopLogger{}), WithSink(sink))
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("err = %v, want the unsupported item's error", err)
+	}
+	if !strings.Contains(err.Error(), "item map[]") {
+		t.Fatalf("err = %q, want it to name the offending item", err)
+	}
+
+	// Each sibling either saw the cancellation in Fetch or before it started.
+	siblings := 0
+	for _, r := range sink.Results() {
+		if _, ok := r.Input.(blockingFetcher); !ok {
+			continue
+		}
+		siblings++
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("sibling finished with %v, want context.Canceled", r.Err)
+		}
+	}
+	if siblings != 3 {
+		t.Fatalf("%d sibling Results, want 3", siblings)
+	}
+}
+
+func TestRunGroupNoError(t *testing.T) {
+	if err := RunGroup(context.Background(), []interface{}{1, "a", true}, WithNoDelay(), WithLogger(nopLogger{})); err != nil {
+		t.Fatalf("RunGroup = %v, want nil", err)
+	}
+}
+
+func TestProcessBatchPrintsNothing(t *testing.T) {
+	log := new(captureLogger)
+	saved := defaultLogger
+	defaultLogger = log
+	defer func() { defaultLogger = saved }()
+
+	results := ProcessBatch(nil, []interface{}{"a", 1, map[int]int{}}, WithNoDelay())
+	if len(results) != 3 || results[2].Kind != KindUnknown {
+		t.Fatalf("results = %v", results)
+	}
+	if lines := log.Lines(); len(lines) != 0 {
+		t.Fatalf("ProcessBatch logged %q", lines)
+	}
+}
+
+func TestDispatchManyItems(t *testing.T) {
+	const n = 500
+	items := make([]interface{}, n)
+	for i := range items {
+		items[i] = i
+	}
+	sink := new(recordingSink)
+
+	wg := Dispatch(context.Background(), items, WithNoDelay(), WithLogger(nopLogger{}), WithSink(sink))
+	// Wait may only return once every item is done, because Add ran
+	// before each launch.
+	wg.Wait()
+	if got := len(sink.Results()); got != n {
+		t.Fatalf("%d items finished by the time Wait returned, want %d", got, n)
+	}
+}
+
+func TestRateLimitSpacesLaunches(t *testing.T) {
+	c := newManualClock()
+	sink := new(recordingSink)
+	items := []interface{}{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	done := make(chan *sync.WaitGroup, 1)
+	go func() {
+		done <- Dispatch(context.Background(), items, WithRateLimit(5), WithClock(c),
+			WithNoDelay(), WithLogger(nopLogger{}), WithSink(sink))
+	}()
+
+	// The first item goes at once, each of the other nine waits a token.
+	for i := 0; i < 9; i++ {
+		waitFor(t, func() bool { return c.Waiters() == 1 })
+		c.Advance(200 * time.Millisecond)
+	}
+	(<-done).Wait()
+
+	results := sink.Results()
+	if len(results) != len(items) {
+		t.Fatalf("%d items processed, want %d", len(results), len(items))
+	}
+	first, last := results[0].StartedAt, results[0].StartedAt
+	for _, r := range results {
+		if r.StartedAt.Before(first) {
+			first = r.StartedAt
+		}
+		if r.StartedAt.After(last) {
+			last = r.StartedAt
+		}
+	}
+	if span := last.Sub(first); span < 1800*time.Millisecond {
+		t.Fatalf("launches spanned %v, want at least 1.8s at 5/s", span)
+	}
+}
+
+func TestRateLimitCancelStopsDispatch(t *testing.T) {
+	c := newManualClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := new(recordingSink)
+
+	done := make(chan *sync.WaitGroup, 1)
+	go func() {
+		done <- Dispatch(ctx, []interface{}{1, 2, 3}, WithRateLimit(1), WithClock(c),
+			WithNoDelay(), WithLogger(nopLogger{}), WithSink(sink))
+	}()
+	waitFor(t, func() bool { return c.Waiters() == 1 })
+	cancel()
+
+	(<-done).Wait()
+	if got := len(sink.Results()); got != 1 {
+		t.Fatalf("%d items dispatched, want only the first", got)
+	}
+}
+
+func TestProcessWithDoneClosed(t *testing.T) {
+	done := make(chan struct{})
+	time.AfterFunc(10*time.Millisecond, func() { close(done) })
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	r := ProcessWithDone(done, &wg, 42, WithWorkDuration(time.Hour), WithLogger(nopLogger{}))
+	wg.Wait()
+	if r.Kind != KindCancelled {
+		t.Fatalf("Kind = %s, want cancelled once done is closed", r.Kind)
+	}
+}
+
+func TestProcessWithDoneNil(t *testing.T) {
+	r := ProcessWithDone(nil, nil, 42, WithWorkDuration(time.Millisecond), WithLogger(nopLogger{}))
+	if r.Kind != KindInt {
+		t.Fatalf("Kind = %s, want int with a nil done channel", r.Kind)
+	}
+}
+
+func TestRunCancellableRecordsCause(t *testing.T) {
+	errAbort := errors.New("operator abort")
+	items := []interface{}{"Alpha", 1, true}
+	results, cancel := RunCancellable(items, WithTimeout(time.Minute), WithWorkDuration(time.Hour), WithLogger(nopLogger{}))
+	cancel(errAbort)
+
+	got := results()
+	if len(got) != len(items) {
+		t.Fatalf("got %d Results, want %d", len(got), len(items))
+	}
+	for _, r := range got {
+		if r.Kind != KindCancelled || !errors.Is(r.CancelCause, errAbort) || !errors.Is(r.Err, errAbort) {
+			t.Errorf("%v: (%s, cause %v), want cancelled by %v", r.Input, r.Kind, r.CancelCause, errAbort)
+		}
+	}
+}
+
+func TestRunCancellableDeadlineCause(t *testing.T) {
+	results, cancel := RunCancellable([]interface{}{1}, WithTimeout(10*time.Millisecond), WithWorkDuration(time.Hour), WithLogger(nopLogger{}))
+	defer cancel(nil)
+
+	for _, r := range results() {
+		if r.CancelCause != context.DeadlineExceeded {
+			t.Errorf("CancelCause = %v, want context.DeadlineExceeded", r.CancelCause)
+		}
+	}
+}
+
+func TestProcessAllFailFastStopsOnTimeout(t *testing.T) {
+	items := []interface{}{1, "Alpha", true}
+	start := time.Now()
+	results, firstTimeout := ProcessAllFailFast(context.Background(), items,
+		WithWorkDuration(time.Hour), WithItemTimeout(50*time.Millisecond), WithLogger(nopLogger{}))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %v, want promptly after the first timeout", elapsed)
+	}
+	if !firstTimeout {
+		t.Error("firstTimeout = false, want true")
+	}
+	if len(results) != len(items) {
+		t.Fatalf("got %d Results, want %d", len(results), len(items))
+	}
+
+	var timedOut bool
+	for _, r := range results {
+		switch {
+		case r.Kind != KindCancelled:
+			t.Errorf("%v finished as %s, want cancelled", r.Input, r.Kind)
+		case errors.Is(r.CancelCause, context.DeadlineExceeded):
+			timedOut = true
+		}
+	}
+	if !timedOut {
+		t.Error("no Result was cancelled by its deadline")
+	}
+}
+
+func TestProcessAllFailFastParentCancelNotTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	results, firstTimeout := ProcessAllFailFast(ctx, []interface{}{1, "Alpha"},
+		WithWorkDuration(time.Hour), WithLogger(nopLogger{}))
+	if firstTimeout {
+		t.Error("firstTimeout = true after a manual cancel, want false")
+	}
+	for _, r := range results {
+		if r.Kind != KindCancelled || !errors.Is(r.CancelCause, context.Canceled) {
+			t.Errorf("%v = (%s, cause %v), want cancelled by the parent", r.Input, r.Kind, r.CancelCause)
+		}
+	}
+}
+
+func TestProcessAllFailFastIgnoresErrors(t *testing.T) {
+	items := []interface{}{1, map[string]int{}, "Alpha"}
+	results, firstTimeout := ProcessAllFailFast(context.Background(), items, WithNoDelay(), WithLogger(nopLogger{}))
+	if firstTimeout {
+		t.Error("firstTimeout = true without a timeout")
+	}
+	if c := Counts(results); c[KindInt] != 1 || c[KindString] != 1 || c[KindUnknown] != 1 {
+		t.Errorf("Counts = %v, want every item processed", c)
+	}
+}
+
+func TestWaitCtxGroupCompletes(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	time.AfterFunc(10*time.Millisecond, wg.Done)
+	if err := WaitCtx(context.Background(), &wg); err != nil {
+		t.Errorf("WaitCtx = %v, want nil", err)
+	}
+}
+
+func TestWaitCtxCancelFirst(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// The waiter goroutine left behind by the early return exits once the
+	// group completes.
+	AssertNoGoroutineLeak(t, func() {
+		if err := WaitCtx(ctx, &wg); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("WaitCtx = %v, want context.DeadlineExceeded", err)
+		}
+		wg.Done()
+	})
+}
+
+// processedLines returns the "Processed" lines logged to log, in order.
+func processedLines(log *captureLogger) []string {
+	var lines []string
+	for _, line := range log.Lines() {
+		if strings.HasPrefix(line, "Processed") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestWithSortDispatchOrder(t *testing.T) {
+	items := []interface{}{3, 1, 4, 2}
+	desc := func(a, b interface{}) bool { return a.(int) > b.(int) }
+	log := new(captureLogger)
+	if _, err := Run(WithItems(items...), WithSort(desc), WithSynchronous(), WithNoDelay(), WithLogger(log)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := []string{"Processed Int: 4", "Processed Int: 3", "Processed Int: 2", "Processed Int: 1"}
+	if got := processedLines(log); !slices.Equal(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+	if !slices.Equal(items, []interface{}{3, 1, 4, 2}) {
+		t.Errorf("WithSort reordered the caller's slice to %v", items)
+	}
+}
+
+func TestWithSortMixedTypes(t *testing.T) {
+	// The comparator alone decides how types compare: here by their
+	// printed form.
+	byString := func(a, b interface{}) bool { return fmt.Sprint(a) < fmt.Sprint(b) }
+	log := new(captureLogger)
+	if _, err := Run(WithItems("b", 2, true, "a"), WithSort(byString), WithSynchronous(), WithNoDelay(), WithLogger(log)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := []string{"Processed Int: 2", "Processed String: a (length 1)", "Processed String: b (length 1)", "Processed Bool: true"}
+	if got := processedLines(log); !slices.Equal(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+}
+
+func TestWithSortNilKeepsOrder(t *testing.T) {
+	log := new(captureLogger)
+	if _, err := Run(WithItems(3, 1, 2), WithSort(nil), WithSynchronous(), WithNoDelay(), WithLogger(log)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{"Processed Int: 3", "Processed Int: 1", "Processed Int: 2"}
+	if got := processedLines(log); !slices.Equal(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+}
+
+func TestProcessOne(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		data interface{}
+		kind Kind
+		err  error
+	}{
+		{"int", context.Background(), 42, KindInt, nil},
+		{"cancelled string", expired, "Alpha", KindCancelled, context.DeadlineExceeded},
+		{"unsupported", context.Background(), Order{}, KindUnknown, ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The dead letter channel must not swallow failed Results.
+			dead := make(chan Result, 1)
+			r := ProcessOne(tt.ctx, tt.data, WithNoDelay(), WithDeadLetter(dead), WithLogger(nopLogger{}))
+			if r.Kind != tt.kind || r.Input != tt.data {
+				t.Errorf("Result = (%s, %v), want (%s, %v)", r.Kind, r.Input, tt.kind, tt.data)
+			}
+			if tt.err == nil && r.Err != nil || tt.err != nil && !errors.Is(r.Err, tt.err) {
+				t.Errorf("Err = %v, want %v", r.Err, tt.err)
+			}
+			if len(dead) != 0 {
+				t.Error("Result also sent to the dead letter channel")
+			}
+		})
+	}
+}
+
+func TestProcessOneHonorsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	r := ProcessOne(ctx, 1, WithWorkDuration(time.Hour), WithLogger(nopLogger{}))
+	if r.Kind != KindCancelled || time.Since(start) > time.Second {
+		t.Errorf("Result = %s after %v, want cancelled at the deadline", r.Kind, time.Since(start))
+	}
+}
+
+func TestProcessMap(t *testing.T) {
+	m := map[string]interface{}{"name": "Alpha", "count": 42, "extra": Order{}}
+	got := ProcessMap(context.Background(), m, WithNoDelay())
+	want := map[string]Kind{"name": KindString, "count": KindInt, "extra": KindUnknown}
+	if len(got) != len(want) {
+		t.Fatalf("got %d Results, want %d", len(got), len(want))
+	}
+	for key, kind := range want {
+		if r := got[key]; r.Kind != kind || r.Input != m[key] {
+			t.Errorf("%s: (%s, %v), want (%s, %v)", key, r.Kind, r.Input, kind, m[key])
+		}
+	}
+}
+
+func TestProcessMapManyKeys(t *testing.T) {
+	m := make(map[string]interface{}, 500)
+	for i := 0; i < 500; i++ {
+		m[fmt.Sprint(i)] = i
+	}
+	got := ProcessMap(context.Background(), m, WithNoDelay())
+	for key, v := range m {
+		if r := got[key]; r.Input != v {
+			t.Fatalf("%s maps to the Result of %v", key, r.Input)
+		}
+	}
+}
+
+func TestProcessMapEmpty(t *testing.T) {
+	got := ProcessMap(nil, nil)
+	if got == nil || len(got) != 0 {
+		t.Errorf("ProcessMap(nil, nil) = %v, want an empty map", got)
+	}
+}
+
+func TestDefaultIDsUnique(t *testing.T) {
+	const batches, n = 4, 1000
+	items := make([]interface{}, n)
+	for i := range items {
+		items[i] = i
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]bool, batches*n)
+	var wg sync.WaitGroup
+	for b := 0; b < batches; b++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := Run(WithItems(items...), WithNoDelay(), WithTimeout(time.Minute), WithLogger(nopLogger{}))
+			if err != nil {
+				t.Errorf("Run: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range results {
+				if r.ID == "" || seen[r.ID] {
+					t.Errorf("ID %q is empty or already used", r.ID)
+				}
+				seen[r.ID] = true
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != batches*n {
+		t.Errorf("%d distinct IDs, want %d", len(seen), batches*n)
+	}
+}
+
+func TestWithIDGenerator(t *testing.T) {
+	next := 0
+	gen := func() string {
+		next++
+		return fmt.Sprintf("job-%d", next)
+	}
+	results, err := Run(WithItems("a", "b", "c"), WithIDGenerator(gen), WithSynchronous(), WithNoDelay(), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for i, r := range results {
+		if want := fmt.Sprintf("job-%d", i+1); r.ID != want {
+			t.Errorf("item %d: ID = %q, want %q", i, r.ID, want)
+		}
+	}
+}
+
+func TestDispatchSynchronousOrder(t *testing.T) {
+	items := []interface{}{"Alpha", 42, true, 2.5, []byte("hi"), "Beta", 7}
+	want := []string{
+		"Processed String: Alpha (length 5)",
+		"Processed Int: 42",
+		"Processed Bool: true",
+		"Processed Float: 2.50",
+		"Processed Bytes: 2 bytes (2 runes)",
+		"Processed String: Beta (length 4)",
+		"Processed Int: 7",
+	}
+	for i := 0; i < 5; i++ {
+		log := new(captureLogger)
+		wg := Dispatch(context.Background(), items, WithSynchronous(), WithMaxInFlight(4), WithNoDelay(), WithLogger(log))
+		// Every item is finished by the time Dispatch returns.
+		if got := processedLines(log); !slices.Equal(got, want) {
+			t.Fatalf("run %d: processed %q, want %q", i, got, want)
+		}
+		wg.Wait()
+	}
+
+	// The concurrent path prints the same lines, in some order.
+	log := new(captureLogger)
+	wg := Dispatch(context.Background(), items, WithNoDelay(), WithLogger(log))
+	wg.Wait()
+	got := processedLines(log)
+	slices.Sort(got)
+	sorted := slices.Clone(want)
+	slices.Sort(sorted)
+	if !slices.Equal(got, sorted) {
+		t.Errorf("concurrent path processed %q, want %q", got, sorted)
+	}
+}
+
+func TestDispatchSynchronousHonorsTimeout(t *testing.T) {
+	results, err := Run(WithItems(1, 2), WithSynchronous(), WithWorkDuration(time.Hour), WithItemTimeout(10*time.Millisecond), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, r := range results {
+		if r.Kind != KindCancelled || !errors.Is(r.Err, context.DeadlineExceeded) {
+			t.Errorf("item %v = (%s, %v), want cancelled by its timeout", r.Input, r.Kind, r.Err)
+		}
+	}
+}
+
+// stackFetcher records the stack of the goroutine fetching it.
+type stackFetcher struct{ stack *string }
+
+func (f stackFetcher) Fetch(context.Context) (string, error) {
+	buf := make([]byte, 1<<16)
+	*f.stack = string(buf[:runtime.Stack(buf, false)])
+	return "ok", nil
+}
+
+func TestDispatchSynchronousCallerStack(t *testing.T) {
+	var stack string
+	wg := Dispatch(context.Background(), []interface{}{stackFetcher{&stack}}, WithSynchronous(), WithNoDelay(), WithLogger(nopLogger{}))
+	wg.Wait()
+	if !strings.Contains(stack, "TestDispatchSynchronousCallerStack") {
+		t.Errorf("item processed off the calling goroutine:\n%s", stack)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ResultSink receives every Result produced by processData. Implementations
+// must be safe for concurrent use, since all workers share one sink.
+//
+// Flush writes out anything Emit buffered. WorkerPool.Shutdown calls it once,
+// after the last Result was emitted; sinks that do not buffer implement it
+// as a no-op.
+type ResultSink interface {
+	Emit(r Result) error
+	Flush() error
+}
+
+// WithSink makes processData hand every Result to s. Errors returned by the
+// sink are logged and do not affect the Result.
+func WithSink(s ResultSink) Option {
+	return func(o *options) {
+		o.sink = s
+	}
+}
+
+// emit hands r to the configured sink, if any.
+func (o *options) emit(r Result) {
+	if o.sink == nil {
+		return
+	}
+	if err := o.sink.Emit(r); err != nil {
+		o.log().Logf("result sink: %v", err)
+	}
+}
+
+// WithDeadLetter makes processData deliver every Result whose Err is set on
+// ch instead of the results channel, so failed, unsupported, panicked and
+// cancelled items can be inspected later. Successful Results still go to
+// the results channel, and the ResultSink, if any, still sees every Result.
+// The send gives up once the item's context is done, counting the Result in
+// Stats.Dropped, so a full dead-letter channel never blocks a cancelled
+// worker.
+func WithDeadLetter(ch chan<- Result) Option {
+	return func(o *options) {
+		o.deadLetter = ch
+	}
+}
+
+// deliver hands r to the dead-letter channel if it failed and one is
+// configured, and to results otherwise.
+func (o *options) deliver(ctx context.Context, results chan<- Result, r Result) {
+	if r.Err == nil || o.deadLetter == nil {
+		o.send(ctx, results, r)
+		return
+	}
+
+	select {
+	case o.deadLetter <- r:
+		return
+	default:
+	}
+
+	select {
+	case o.deadLetter <- r:
+	case <-ctx.Done():
+		o.stats.drop(1)
+	}
+}
+
+// multiSink forwards every Result to each of its sinks.
+type multiSink []ResultSink
+
+// MultiSink returns a ResultSink that forwards every Result to each of
+// sinks in turn. A failing sink does not stop the others from receiving the
+// Result; all errors are combined with errors.Join. MultiSink adds no
+// locking of its own, so it is as safe for concurrent use as the sinks it
+// wraps.
+func MultiSink(sinks ...ResultSink) ResultSink {
+	return multiSink(append([]ResultSink(nil), sinks...))
+}
+
+// Emit hands r to every sink and joins their errors.
+func (m multiSink) Emit(r Result) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Emit(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush flushes every sink and joins their errors.
+func (m multiSink) Flush() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// jsonResult is the wire form of a Result written by JSONSink.
+type jsonResult struct {
+	Input  string `json:"input"`
+	Kind   string `json:"kind"`
+	Output string `json:"output"`
+	Err    string `json:"error,omitempty"`
+}
+
+// JSONSink writes each Result to an io.Writer as one JSON object per line.
+type JSONSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONSink returns a JSONSink writing newline-delimited JSON to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{enc: json.NewEncoder(w)}
+}
+
+// Emit writes r as a single JSON line. The Input is rendered with %v so that
+// payloads json.Marshal cannot encode, such as channels or funcs, are still
+// written. Concurrent calls are serialized so lines never interleave.
+func (s *JSONSink) Emit(r Result) error {
+	jr := jsonResult{
+		Input:  fmt.Sprintf("%v", r.Input),
+		Kind:   r.Kind.String(),
+		Output: r.Output,
+	}
+	if r.Err != nil {
+		jr.Err = r.Err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(jr)
+}
+
+// Flush is a no-op: Emit writes every line straight to the io.Writer.
+func (s *JSONSink) Flush() error {
+	return nil
+}
+
+// csvSink is the ResultSink returned by CSVSink.
+type csvSink struct {
+	mu     sync.Mutex
+	w      *csv.Writer
+	header bool // whether the header row has been written
+}
+
+// CSVSink returns a ResultSink writing each Result to w as a CSV row of
+// input_type, input, kind, output and error, after a header row naming
+// those columns. The Input is rendered with %T and %v and a nil Err as an
+// empty field; quoting is left to encoding/csv. Concurrent calls are
+// serialized and every row is flushed before Emit returns, so none is lost
+// if the program stops.
+func CSVSink(w io.Writer) ResultSink {
+	return &csvSink{w: csv.NewWriter(w)}
+}
+
+// Emit writes r as one CSV row, preceded by the header on the first call.
+func (s *csvSink) Emit(r Result) error {
+	var errText string
+	if r.Err != nil {
+		errText = r.Err.Error()
+	}
+	row := []string{fmt.Sprintf("%T", r.Input), fmt.Sprintf("%v", r.Input), r.Kind.String(), r.Output, errText}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.header {
+		if err := s.w.Write([]string{"input_type", "input", "kind", "output", "error"}); err != nil {
+			return err
+		}
+		s.header = true
+	}
+	if err := s.w.Write(row); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// Flush flushes the csv.Writer, reporting any earlier write error.
+func (s *csvSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// RecentSink is a ResultSink that keeps only the most recent Results in a
+// fixed-size ring, for a rolling "last N processed" view of a long-running
+// pool. It is safe for concurrent use.
+type RecentSink struct {
+	mu   sync.Mutex
+	buf  []Result
+	next int // index the next Result is written to
+	full bool
+}
+
+// RingAccumulator returns a RecentSink retaining the last capacity Results,
+// evicting the oldest as new ones arrive. A capacity below one is raised to
+// one.
+func RingAccumulator(capacity int) *RecentSink {
+	return &RecentSink{buf: make([]Result, max(capacity, 1))}
+}
+
+// Emit records r, evicting the oldest Result if the ring is full. It never
+// fails.
+func (s *RecentSink) Emit(r Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf[s.next] = r
+	s.next = (s.next + 1) % len(s.buf)
+	if s.next == 0 {
+		s.full = true
+	}
+	return nil
+}
+
+// Flush is a no-op: the ring is only held in memory.
+func (s *RecentSink) Flush() error {
+	return nil
+}
+
+// Recent returns a copy of the retained Results, oldest first.
+func (s *RecentSink) Recent() []Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.full {
+		return append([]Result(nil), s.buf[:s.next]...)
+	}
+	recent := make([]Result, 0, len(s.buf))
+	recent = append(recent, s.buf[s.next:]...)
+	return append(recent, s.buf[:s.next]...)
+}
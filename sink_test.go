@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJSONSinkLines(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONSink(&buf)
+	items := []interface{}{"Alpha", 42, make(chan int), struct{}{}}
+
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		go processData(context.Background(), &wg, item, nil, WithNoDelay(), WithLogger(nopLogger{}), WithSink(sink))
+	}
+	wg.Wait()
+
+	kinds := make(map[string]int)
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var jr jsonResult
+		if err := json.Unmarshal(sc.Bytes(), &jr); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		kinds[jr.Kind]++
+		if jr.Kind == "unknown" && jr.Err == "" {
+			t.Errorf("unknown Result %q has no error", sc.Text())
+		}
+	}
+	if kinds["string"] != 1 || kinds["int"] != 1 || kinds["unknown"] != 2 {
+		t.Fatalf("decoded kinds %v, want one string, one int and two unknown", kinds)
+	}
+}
+
+// failingSink is a ResultSink whose Emit always fails, counting its calls.
+type failingSink struct{ calls int32 }
+
+var errSinkDown = errors.New("sink down")
+
+func (s *failingSink) Emit(Result) error {
+	atomic.AddInt32(&s.calls, 1)
+	return errSinkDown
+}
+
+func (s *failingSink) Flush() error { return nil }
+
+func TestMultiSink(t *testing.T) {
+	a, b, bad := new(recordingSink), new(recordingSink), new(failingSink)
+	log := new(captureLogger)
+	sink := MultiSink(a, bad, b)
+
+	processData(context.Background(), nil, 42, nil, WithNoDelay(), WithLogger(log), WithSink(sink))
+	if len(a.Results()) != 1 || len(b.Results()) != 1 || bad.calls != 1 {
+		t.Fatalf("sinks got %d, %d and %d Results, want one each", len(a.Results()), len(b.Results()), bad.calls)
+	}
+	if !log.contains("result sink: sink down") {
+		t.Fatalf("log = %q, want the sink error", log.Lines())
+	}
+
+	if err := sink.Emit(Result{}); !errors.Is(err, errSinkDown) {
+		t.Fatalf("Emit = %v, want the failing sink's error", err)
+	}
+	if err := sink.Flush(); err != nil || a.flushes != 1 || b.flushes != 1 {
+		t.Fatalf("Flush = %v with %d and %d flushes, want every sink flushed", err, a.flushes, b.flushes)
+	}
+}
+
+func TestDeadLetterReceivesFailures(t *testing.T) {
+	dead, ok := make(chan Result, 1), make(chan Result, 1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go processData(context.Background(), &wg, struct{}{}, ok, WithNoDelay(), WithDeadLetter(dead), WithLogger(nopLogger{}))
+	go processData(context.Background(), &wg, 42, ok, WithNoDelay(), WithDeadLetter(dead), WithLogger(nopLogger{}))
+	wg.Wait()
+
+	if r := <-dead; r.Kind != KindUnknown || !errors.Is(r.Err, ErrUnsupportedType) {
+		t.Errorf("dead letter got (%s, %v), want the unsupported item", r.Kind, r.Err)
+	}
+	if r := <-ok; r.Kind != KindInt || r.Err != nil {
+		t.Errorf("results got (%s, %v), want the int", r.Kind, r.Err)
+	}
+	if len(dead) != 0 || len(ok) != 0 {
+		t.Error("a Result was delivered twice")
+	}
+}
+
+func TestDeadLetterSendRespectsCancel(t *testing.T) {
+	stats := new(Stats)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Nobody reads dead, so only the cancellation can free the send.
+		processData(ctx, nil, struct{}{}, nil, WithNoDelay(), WithDeadLetter(make(chan Result)),
+			WithStats(stats), WithLogger(nopLogger{}))
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dead-letter send blocked after cancel")
+	}
+	if got := atomic.LoadInt64(&stats.Dropped); got != 1 {
+		t.Errorf("Dropped = %d, want 1", got)
+	}
+}
+
+func TestRingAccumulatorKeepsLatest(t *testing.T) {
+	const capacity = 5
+	ring := RingAccumulator(capacity)
+	if got := ring.Recent(); len(got) != 0 {
+		t.Fatalf("Recent() on an empty ring = %v", got)
+	}
+	for i := 0; i < 2*capacity; i++ {
+		ring.Emit(Result{Input: i})
+	}
+
+	got := ring.Recent()
+	if len(got) != capacity {
+		t.Fatalf("Recent() holds %d Results, want %d", len(got), capacity)
+	}
+	for i, r := range got {
+		if want := capacity + i; r.Input != want {
+			t.Errorf("Recent()[%d] = %v, want %d", i, r.Input, want)
+		}
+	}
+}
+
+func TestRingAccumulatorPartial(t *testing.T) {
+	ring := RingAccumulator(4)
+	ring.Emit(Result{Input: 0})
+	ring.Emit(Result{Input: 1})
+	if got := ring.Recent(); len(got) != 2 || got[0].Input != 0 || got[1].Input != 1 {
+		t.Errorf("Recent() = %v, want 0 then 1", got)
+	}
+
+	// A capacity below one is raised to one.
+	ring = RingAccumulator(0)
+	ring.Emit(Result{Input: 0})
+	ring.Emit(Result{Input: 1})
+	if got := ring.Recent(); len(got) != 1 || got[0].Input != 1 {
+		t.Errorf("RingAccumulator(0).Recent() = %v, want only 1", got)
+	}
+}
+
+func TestRingAccumulatorConcurrent(t *testing.T) {
+	ring := RingAccumulator(16)
+	p := newStartedPool(t, 8, WithSink(ring))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			ring.Recent()
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	p.Wait()
+	wg.Wait()
+	if got := len(ring.Recent()); got != 16 {
+		t.Errorf("Recent() holds %d Results, want 16", got)
+	}
+}
+
+func TestCSVSinkRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	sink := CSVSink(&buf)
+	results := []Result{
+		{Input: 42, Kind: KindInt, Output: "Processed Int: 42"},
+		{Input: `say "hi", then go`, Kind: KindString, Output: "a, b\nc"},
+		{Input: Order{ID: 7}, Kind: KindUnknown, Output: "Unknown type encountered", Err: &UnsupportedTypeError{Type: reflect.TypeFor[Order]()}},
+	}
+	for _, r := range results {
+		if err := sink.Emit(r); err != nil {
+			t.Fatalf("Emit: %v", err)
+		}
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("re-parsing the CSV: %v", err)
+	}
+	want := [][]string{
+		{"input_type", "input", "kind", "output", "error"},
+		{"int", "42", "int", "Processed Int: 42", ""},
+		{"string", `say "hi", then go`, "string", "a, b\nc", ""},
+		{"main.Order", "{7 0}", "unknown", "Unknown type encountered", "unsupported type: main.Order"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+}
+
+func TestCSVSinkConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	p := newStartedPool(t, 8, WithSink(CSVSink(&buf)))
+	const n = 200
+	for i := 0; i < n; i++ {
+		if err := p.Submit(i); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("re-parsing the CSV: %v", err)
+	}
+	if len(rows) != n+1 || rows[0][0] != "input_type" {
+		t.Errorf("got %d rows, want a header and %d Results", len(rows), n)
+	}
+}
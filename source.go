@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+// SourceFromReader streams the newline-delimited values read from r,
+// decoded by decode, on the returned channel, ready to be submitted to a
+// WorkerPool or fed to a Pipeline. Lines are read one at a time, so memory
+// stays bounded however large the input. Lines that fail to decode, and a
+// read error ending the stream, are logged through the Logger set in opts
+// and skipped. The channel is closed at end of input, on a read error, or
+// as soon as ctx is cancelled.
+func SourceFromReader(ctx context.Context, r io.Reader, decode func(string) (interface{}, error), opts ...Option) <-chan interface{} {
+	log := newOptions(opts).log()
+	out := make(chan interface{})
+
+	go func() {
+		defer close(out)
+
+		sc := bufio.NewScanner(r)
+		for line := 1; sc.Scan(); line++ {
+			v, err := decode(sc.Text())
+			if err != nil {
+				log.Logf("source: line %d: %v", line, err)
+				continue
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := sc.Err(); err != nil {
+			log.Logf("source: %v", err)
+		}
+	}()
+
+	return out
+}
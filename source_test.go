@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeInt is a SourceFromReader decode func for base-10 ints.
+func decodeInt(s string) (interface{}, error) {
+	return strconv.Atoi(s)
+}
+
+func TestSourceFromReaderLines(t *testing.T) {
+	var got []interface{}
+	for v := range SourceFromReader(context.Background(), strings.NewReader("1\n2\n3\n"), decodeInt) {
+		got = append(got, v)
+	}
+	if want := []interface{}{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("payloads = %v, want %v", got, want)
+	}
+}
+
+func TestSourceFromReaderLogsDecodeErrors(t *testing.T) {
+	log := new(captureLogger)
+	var got []interface{}
+	for v := range SourceFromReader(context.Background(), strings.NewReader("1\nx\n3"), decodeInt, WithLogger(log)) {
+		got = append(got, v)
+	}
+	if want := []interface{}{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("payloads = %v, want %v", got, want)
+	}
+	if !log.contains("source: line 2:") {
+		t.Errorf("decode error not logged, got %q", log.Lines())
+	}
+}
+
+// endlessReader yields "1\n" forever.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = "1\n"[i%2]
+	}
+	return len(p) &^ 1, nil
+}
+
+func TestSourceFromReaderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := SourceFromReader(ctx, endlessReader{}, decodeInt)
+	<-out
+	cancel()
+
+	// The input never ends, so only the cancellation can close out.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range out {
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import "context"
+
+// State is where an item is in its life cycle, as reported to the
+// WithOnTransition callback.
+type State int
+
+const (
+	// Queued items are waiting to be processed.
+	Queued State = iota
+	// Running items are being processed.
+	Running
+	// Done items were processed successfully.
+	Done
+	// Cancelled items were stopped by their context, before or while running.
+	Cancelled
+	// Failed items ended with an error other than cancellation.
+	Failed
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Queued:
+		return "Queued"
+	case Running:
+		return "Running"
+	case Done:
+		return "Done"
+	case Cancelled:
+		return "Cancelled"
+	case Failed:
+		return "Failed"
+	}
+	return "State(?)"
+}
+
+// WithOnTransition makes processData call fn every time an item changes
+// state: Queued to Running when its work starts, then Running to Done,
+// Cancelled or Failed; an item cancelled before it starts goes straight
+// from Queued to Cancelled. No other transitions are ever reported.
+// itemIndex is the item's position in its batch, or its submission order in
+// a WorkerPool, and -1 when the item was processed on its own.
+//
+// fn runs synchronously on the worker goroutine, so it must be fast and must
+// not block.
+func WithOnTransition(fn func(itemIndex int, from, to State)) Option {
+	return func(o *options) {
+		o.onTransition = fn
+	}
+}
+
+// transition reports that the item processed under ctx went from one state
+// to another.
+func (o *options) transition(ctx context.Context, from, to State) {
+	if o.onTransition != nil {
+		o.onTransition(itemIndexFromContext(ctx), from, to)
+	}
+}
+
+// finalState returns the state an item ends in with Result r.
+func finalState(r Result) State {
+	switch {
+	case r.Kind == KindCancelled, r.Kind == KindSkipped:
+		return Cancelled
+	case r.Err != nil:
+		return Failed
+	}
+	return Done
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type transition struct {
+	item     int
+	from, to State
+}
+
+// transitionRecorder collects the transitions reported to its option.
+type transitionRecorder struct {
+	mu   sync.Mutex
+	seen []transition
+}
+
+func (r *transitionRecorder) option() Option {
+	return WithOnTransition(func(item int, from, to State) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.seen = append(r.seen, transition{item, from, to})
+	})
+}
+
+// of returns the transitions of item, in the order they were reported.
+func (r *transitionRecorder) of(item int) []transition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ts []transition
+	for _, t := range r.seen {
+		if t.item == item {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+func TestOnTransitionSequences(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		data interface{}
+		want []transition
+	}{
+		{"done", context.Background(), 42, []transition{{-1, Queued, Running}, {-1, Running, Done}}},
+		{"failed", context.Background(), Order{}, []transition{{-1, Queued, Running}, {-1, Running, Failed}}},
+		{"cancelled before start", expired, 42, []transition{{-1, Queued, Cancelled}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := new(transitionRecorder)
+			Classify(tt.ctx, tt.data, WithNoDelay(), rec.option(), WithLogger(nopLogger{}))
+			if got := rec.of(-1); !slices.Equal(got, tt.want) {
+				t.Errorf("transitions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnTransitionBatchIndexes(t *testing.T) {
+	rec := new(transitionRecorder)
+	items := []interface{}{"Alpha", 42, true}
+	if _, err := Run(WithItems(items...), WithNoDelay(), rec.option(), WithLogger(nopLogger{})); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for i := range items {
+		want := []transition{{i, Queued, Running}, {i, Running, Done}}
+		if got := rec.of(i); !slices.Equal(got, want) {
+			t.Errorf("item %d: transitions = %v, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts how items left processData. The counters are updated with
+// sync/atomic, so a single Stats may be shared by any number of workers;
+// read them with atomic.LoadInt64 while work is still in flight.
+type Stats struct {
+	Completed int64 // items processed by a handled type switch case
+	Cancelled int64 // items whose context was done before the work finished, or skipped for lack of time
+	Unknown   int64 // unsupported or oversized payloads, failed fetches and items whose processing panicked
+
+	Dropped   int64 // Results lost to the overflow policy or to a cancelled send
+	Filtered  int64 // items WithFilter kept from being processed at all
+	SlowCount int64 // items still running after the WithSlowWarning threshold
+
+	// Processing time of every recorded item and queue wait of those with a
+	// known EnqueuedAt, in nanoseconds, and the per-Kind counts behind
+	// WriteMetrics.
+	latencySum     int64
+	latencyCount   int64
+	queueWaitSum   int64
+	queueWaitCount int64
+	mu             sync.Mutex
+	kinds          map[string]int64
+}
+
+// WithStats makes processData record every Result in s.
+func WithStats(s *Stats) Option {
+	return func(o *options) {
+		o.stats = s
+	}
+}
+
+// record increments the counters matching r, which took d to process. It
+// is a no-op on a nil Stats.
+func (s *Stats) record(r Result, d time.Duration) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddInt64(&s.latencySum, int64(d))
+	atomic.AddInt64(&s.latencyCount, 1)
+	if !r.EnqueuedAt.IsZero() {
+		atomic.AddInt64(&s.queueWaitSum, int64(r.QueueWait))
+		atomic.AddInt64(&s.queueWaitCount, 1)
+	}
+	s.mu.Lock()
+	if s.kinds == nil {
+		s.kinds = make(map[string]int64)
+	}
+	s.kinds[r.Kind.String()]++
+	s.mu.Unlock()
+
+	switch r.Kind {
+	case KindCancelled, KindSkipped:
+		atomic.AddInt64(&s.Cancelled, 1)
+	case KindUnknown, KindRejected, KindFailed, KindPanic:
+		atomic.AddInt64(&s.Unknown, 1)
+	default:
+		atomic.AddInt64(&s.Completed, 1)
+	}
+}
+
+// AverageProcessTime reports the mean ProcessTime of the recorded items, or
+// zero if there are none.
+func (s *Stats) AverageProcessTime() time.Duration {
+	return average(&s.latencySum, &s.latencyCount)
+}
+
+// AverageQueueWait reports the mean QueueWait of the recorded items whose
+// EnqueuedAt is known, or zero if there are none.
+func (s *Stats) AverageQueueWait() time.Duration {
+	return average(&s.queueWaitSum, &s.queueWaitCount)
+}
+
+// average divides the nanoseconds in sum by count, both read atomically.
+func average(sum, count *int64) time.Duration {
+	n := atomic.LoadInt64(count)
+	if n == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(sum) / n)
+}
+
+// WithSlowWarning makes processData log a slow item warning, and count it in
+// Stats.SlowCount, for every item still running threshold after it started.
+// The item itself is unaffected and may still complete or be cancelled. A
+// threshold of zero disables the warning and a negative one is invalid.
+func WithSlowWarning(threshold time.Duration) Option {
+	return func(o *options) {
+		if threshold < 0 {
+			o.reject("WithSlowWarning", threshold, "negative duration")
+			return
+		}
+		o.slowAfter = threshold
+	}
+}
+
+// watchSlow starts the WithSlowWarning timer for data and returns the
+// function that stops it, to be called once the item is done.
+func (o *options) watchSlow(log Logger, data interface{}) (stop func()) {
+	if o.slowAfter <= 0 {
+		return func() {}
+	}
+
+	warn := func() {
+		log.Logf("Slow item warning: %v still running after %v", data, o.slowAfter)
+		if o.stats != nil {
+			atomic.AddInt64(&o.stats.SlowCount, 1)
+		}
+	}
+
+	return afterFunc(o.clk(), o.slowAfter, warn)
+}
+
+// TypeCounter counts the items processData sees by the dynamic type of
+// their payload, as printed by %T, including types it does not handle. The
+// zero value is ready to use and a single TypeCounter may be shared by any
+// number of workers.
+type TypeCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// WithTypeCounter makes processData count every item in c.
+func WithTypeCounter(c *TypeCounter) Option {
+	return func(o *options) {
+		o.types = c
+	}
+}
+
+// record counts one item carrying data. It is a no-op on a nil TypeCounter.
+func (c *TypeCounter) record(data interface{}) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[fmt.Sprintf("%T", data)]++
+}
+
+// TypeCounts returns a copy of the per-type counts, so the caller may keep
+// it while items are still being counted. It always returns a non-nil map.
+func (c *TypeCounter) TypeCounts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int, len(c.counts))
+	for t, n := range c.counts {
+		counts[t] = n
+	}
+	return counts
+}
+
+// WithSummary makes Run log one last line before "Program exit", such as
+// "Processed 3 items: 2 ok, 1 cancelled, 0 unknown in 210ms", from the Stats
+// of the batch and the time from dispatching the first item until every
+// worker finished. It goes through the configured Logger and is off by
+// default. With WithStats, only the items of this batch are counted.
+func WithSummary() Option {
+	return func(o *options) {
+		o.summary = true
+	}
+}
+
+// statsCounts is a copy of the Stats outcome counters.
+type statsCounts struct {
+	completed, cancelled, unknown int64
+}
+
+// counts reads the outcome counters of s, all zero for a nil Stats.
+func (s *Stats) counts() statsCounts {
+	if s == nil {
+		return statsCounts{}
+	}
+	return statsCounts{
+		completed: atomic.LoadInt64(&s.Completed),
+		cancelled: atomic.LoadInt64(&s.Cancelled),
+		unknown:   atomic.LoadInt64(&s.Unknown),
+	}
+}
+
+// since returns the counts recorded after before was read.
+func (c statsCounts) since(before statsCounts) statsCounts {
+	return statsCounts{
+		completed: c.completed - before.completed,
+		cancelled: c.cancelled - before.cancelled,
+		unknown:   c.unknown - before.unknown,
+	}
+}
+
+// log writes the WithSummary line for c, counted over elapsed.
+func (c statsCounts) log(log Logger, elapsed time.Duration) {
+	log.Logf("Processed %d items: %d ok, %d cancelled, %d unknown in %v",
+		c.completed+c.cancelled+c.unknown, c.completed, c.cancelled, c.unknown, elapsed.Round(time.Millisecond))
+}
+
+// RunWithStats is Run, returning the Stats populated by the batch once every
+// worker has finished, or Run's error.
+func RunWithStats(opts ...Option) (*Stats, error) {
+	stats := new(Stats)
+	if _, err := Run(append(opts[:len(opts):len(opts)], WithStats(stats))...); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunWithStatsLeavesCallerSliceAlone(t *testing.T) {
+	marked := false
+	opts := make([]Option, 0, 4)
+	opts = append(opts, WithItems(1, "a"), WithNoDelay(), WithLogger(nopLogger{}))
+	spare := opts[:cap(opts)]
+	spare[3] = func(*options) { marked = true }
+
+	stats, err := RunWithStats(opts...)
+	if err != nil {
+		t.Fatalf("RunWithStats: %v", err)
+	}
+	if stats.Completed != 2 {
+		t.Fatalf("Completed = %d, want 2", stats.Completed)
+	}
+
+	// The spare capacity must still hold the caller's Option, not WithStats.
+	marked = false
+	spare[3](new(options))
+	if !marked {
+		t.Fatal("RunWithStats overwrote the spare capacity of the caller's slice")
+	}
+}
+
+func TestStatsCountsEveryExitPath(t *testing.T) {
+	stats := new(Stats)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	const perKind = 50
+	var wg sync.WaitGroup
+	for i := 0; i < perKind; i++ {
+		wg.Add(3)
+		go processData(ctx, &wg, i, nil, WithNoDelay(), WithStats(stats), WithLogger(nopLogger{}))
+		go processData(ctx, &wg, i, nil, WithWorkDuration(time.Hour), WithStats(stats), WithLogger(nopLogger{}))
+		go processData(ctx, &wg, struct{}{}, nil, WithNoDelay(), WithStats(stats), WithLogger(nopLogger{}))
+	}
+	wg.Wait()
+
+	completed := atomic.LoadInt64(&stats.Completed)
+	cancelled := atomic.LoadInt64(&stats.Cancelled)
+	unknown := atomic.LoadInt64(&stats.Unknown)
+	if completed+cancelled+unknown != 3*perKind {
+		t.Fatalf("Completed+Cancelled+Unknown = %d+%d+%d, want %d", completed, cancelled, unknown, 3*perKind)
+	}
+	if cancelled < perKind || unknown != perKind {
+		t.Fatalf("Cancelled = %d, Unknown = %d, want at least %d and exactly %d", cancelled, unknown, perKind, perKind)
+	}
+}
+
+func TestTypeCounterCountsMix(t *testing.T) {
+	c := new(TypeCounter)
+	p := newStartedPool(t, 4, WithTypeCounter(c))
+	items := []interface{}{"a", "b", "c", 1, 2, true, Order{}}
+	for _, item := range items {
+		if err := p.Submit(item); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	p.Wait()
+
+	want := map[string]int{"string": 3, "int": 2, "bool": 1, "main.Order": 1}
+	if got := c.TypeCounts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TypeCounts() = %v, want %v", got, want)
+	}
+}
+
+func TestTypeCountsIsACopy(t *testing.T) {
+	c := new(TypeCounter)
+	if got := c.TypeCounts(); got == nil || len(got) != 0 {
+		t.Fatalf("TypeCounts() on an empty counter = %v, want an empty map", got)
+	}
+	Classify(context.Background(), 1, WithNoDelay(), WithTypeCounter(c), WithLogger(nopLogger{}))
+	snap := c.TypeCounts()
+	snap["int"] = 100
+	if got := c.TypeCounts()["int"]; got != 1 {
+		t.Errorf("count changed to %d through the returned map", got)
+	}
+}
+
+func TestWithSlowWarningFiresOnce(t *testing.T) {
+	c := newManualClock()
+	log := new(captureLogger)
+	stats := new(Stats)
+	done := make(chan Result, 1)
+	go func() {
+		done <- Classify(context.Background(), 42, WithClock(c), WithWorkDuration(100*time.Millisecond),
+			WithSlowWarning(50*time.Millisecond), WithStats(stats), WithLogger(log))
+	}()
+	// One timer for the work, one for the warning.
+	waitFor(t, func() bool { return c.Waiters() == 2 })
+
+	c.Advance(50 * time.Millisecond)
+	waitFor(t, func() bool { return atomic.LoadInt64(&stats.SlowCount) == 1 })
+	c.Advance(50 * time.Millisecond)
+	if r := <-done; r.Kind != KindInt {
+		t.Fatalf("Kind = %s, want the slow item to finish normally", r.Kind)
+	}
+
+	warnings := 0
+	for _, line := range log.Lines() {
+		if strings.HasPrefix(line, "Slow item warning: 42 still running after 50ms") {
+			warnings++
+		}
+	}
+	if slow := atomic.LoadInt64(&stats.SlowCount); warnings != 1 || slow != 1 {
+		t.Errorf("warned %d times, SlowCount %d, want 1 and 1", warnings, slow)
+	}
+}
+
+func TestWithSlowWarningStoppedOnCompletion(t *testing.T) {
+	log := new(captureLogger)
+	stats := new(Stats)
+	Classify(context.Background(), 42, WithWorkDuration(5*time.Millisecond),
+		WithSlowWarning(30*time.Millisecond), WithStats(stats), WithLogger(log))
+	time.Sleep(60 * time.Millisecond)
+	if log.contains("Slow item warning") || atomic.LoadInt64(&stats.SlowCount) != 0 {
+		t.Errorf("warned about an item that finished in time: %q", log.Lines())
+	}
+}
+
+func TestWithSummaryCounts(t *testing.T) {
+	c := newManualClock()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		// Step the clock by 25ms whenever an item's work timer is pending
+		// next to the batch deadline, so neither ever fires on a tie.
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			if c.Waiters() == 2 {
+				c.Advance(25 * time.Millisecond)
+			}
+		}
+	}()
+
+	// Processed one at a time, 50ms each: "Alpha" completes at 50ms, the
+	// Order is unknown at 100ms, 42 is cut short by the deadline at 125ms
+	// and true is cancelled before it starts.
+	log := new(captureLogger)
+	_, err := Run(WithItems("Alpha", Order{}, 42, true), WithSynchronous(), WithClock(c),
+		WithWorkDuration(50*time.Millisecond), WithTimeout(125*time.Millisecond), WithSummary(), WithLogger(log))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	lines := log.Lines()
+	want := []string{"Processed 4 items: 1 ok, 2 cancelled, 1 unknown in 125ms", "Program exit"}
+	if len(lines) < 2 || !reflect.DeepEqual(lines[len(lines)-2:], want) {
+		t.Errorf("last lines = %q, want %q", lines, want)
+	}
+}
+
+func TestWithSummaryOffByDefault(t *testing.T) {
+	log := new(captureLogger)
+	if _, err := Run(WithItems("Alpha"), WithNoDelay(), WithLogger(log)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if log.contains("items:") {
+		t.Errorf("summary logged without WithSummary: %q", log.Lines())
+	}
+}
+
+func TestWithSummaryCountsOnlyItsBatch(t *testing.T) {
+	stats := new(Stats)
+	if _, err := Run(WithItems(1, 2), WithNoDelay(), WithStats(stats), WithLogger(nopLogger{})); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	log := new(captureLogger)
+	if _, err := Run(WithItems("a"), WithNoDelay(), WithStats(stats), WithSummary(), WithLogger(log)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !log.contains("Processed 1 items: 1 ok, 0 cancelled, 0 unknown in ") {
+		t.Errorf("summary %q, want only the second batch counted", log.Lines())
+	}
+}
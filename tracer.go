@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tracer starts a span around the processing of each item, in the style of
+// OpenTelemetry. StartSpan returns the context carrying the span, which
+// processData uses for the rest of the item so trace context propagates,
+// and the function ending the span with the item's error, nil on success.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, func(err error))
+}
+
+// SpanAttributer is implemented by Tracers that record attributes on the
+// span carried by ctx. processData sets "payload.type" to the payload's
+// dynamic type on every span it starts.
+type SpanAttributer interface {
+	SetAttribute(ctx context.Context, key, value string)
+}
+
+// spanName is the name of the span started for every item.
+const spanName = "processData"
+
+// WithTracer makes processData trace every item with t. A nil t keeps the
+// default, which traces nothing.
+func WithTracer(t Tracer) Option {
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
+// nopTracer is the default Tracer. It returns ctx unchanged and its end
+// function does nothing.
+type nopTracer struct{}
+
+// StartSpan returns ctx and a no-op end function.
+func (nopTracer) StartSpan(ctx context.Context, _ string) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+
+// startSpan starts the span for an item carrying data.
+func (o *options) startSpan(ctx context.Context, data interface{}) (context.Context, func(error)) {
+	if o.tracer == nil {
+		return nopTracer{}.StartSpan(ctx, spanName)
+	}
+
+	ctx, end := o.tracer.StartSpan(ctx, spanName)
+	if a, ok := o.tracer.(SpanAttributer); ok {
+		a.SetAttribute(ctx, "payload.type", fmt.Sprintf("%T", data))
+	}
+	return ctx, end
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type spanKey struct{}
+
+// fakeSpan is one span started by a fakeTracer.
+type fakeSpan struct {
+	name  string
+	attrs map[string]string
+	ends  int
+	err   error
+}
+
+// fakeTracer records every span it starts.
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (tr *fakeTracer) StartSpan(ctx context.Context, name string) (context.Context, func(error)) {
+	s := &fakeSpan{name: name, attrs: make(map[string]string)}
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, s)
+	tr.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, s), func(err error) {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		s.ends++
+		s.err = err
+	}
+}
+
+func (tr *fakeTracer) SetAttribute(ctx context.Context, key, value string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	ctx.Value(spanKey{}).(*fakeSpan).attrs[key] = value
+}
+
+// spanFetcher reports whether its Fetch ran under a span.
+type spanFetcher struct{}
+
+func (spanFetcher) Fetch(ctx context.Context) (string, error) {
+	if _, ok := ctx.Value(spanKey{}).(*fakeSpan); !ok {
+		return "", errors.New("no span in the fetch context")
+	}
+	return "traced", nil
+}
+
+func TestTracerSpanPerItem(t *testing.T) {
+	tr := new(fakeTracer)
+	items := []interface{}{42, "Alpha", Order{}, spanFetcher{}}
+	results := ProcessBatch(context.Background(), items, WithNoDelay(), WithTracer(tr), WithLogger(nopLogger{}))
+	if r := results[3]; r.Kind != KindFetched {
+		t.Errorf("Fetcher finished as (%s, %v), want it to see the span context", r.Kind, r.Err)
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if len(tr.spans) != len(items) {
+		t.Fatalf("started %d spans, want %d", len(tr.spans), len(items))
+	}
+	types := make(map[string]*fakeSpan)
+	for _, s := range tr.spans {
+		if s.name != "processData" || s.ends != 1 {
+			t.Errorf("span %q ended %d times, want processData ended once", s.name, s.ends)
+		}
+		types[s.attrs["payload.type"]] = s
+	}
+	for _, want := range []string{"int", "string", "main.Order", "main.spanFetcher"} {
+		if types[want] == nil {
+			t.Errorf("no span with payload.type %q", want)
+		}
+	}
+	if s := types["main.Order"]; s != nil && !errors.Is(s.err, ErrUnsupportedType) {
+		t.Errorf("unsupported item's span ended with %v, want ErrUnsupportedType", s.err)
+	}
+	if s := types["int"]; s != nil && s.err != nil {
+		t.Errorf("int span ended with %v, want nil", s.err)
+	}
+}
@@ -1,58 +1,438 @@
-package main
-
-// STEP 1: Setup and Imports
-// Import the following packages: fmt, context, sync, time.
-
-// STEP 2: Define the Worker Function
-// Define a function named processData.
-// Arguments:
-// 1. ctx of type context.Context
-// 2. wg as a pointer to sync.WaitGroup
-// 3. data as an empty interface (interface{})
-func processData( /* arguments here */ ) {
-
-	// STEP 3: Implement WaitGroup Signal
-	// Strictly as the first line: defer the call to signal the wait group (wg.Done()).
-
-	// STEP 4: Implement Type Assertion (The "Check")
-	// Use the "comma-ok" idiom to check if 'data' is a string.
-	// If it is a string, print: "Checking string length...".
-	// Do not perform other logic here.
-
-	// STEP 5: Implement the Context/Timeout Logic
-	// Create a select statement.
-	// Case 1: Check if ctx.Done().
-	//    Inside this case, print "Context cancelled for data: " followed by the data value.
-	//    Return immediately.
-	// Case 2: Simulate work using time.After(500 * time.Millisecond).
-	//    This case will contain the logic for Step 6.
-
-		// STEP 6: Implement Type Switch (The "Processing")
-		// Inside the time.After case:
-		// Create a type switch on 'data'.
-		// Case string: Print "Processed String: " followed by the string value.
-		// Case int: Print "Processed Int: " followed by the integer value.
-		// Default: Print "Unknown type encountered".
-
-}
-
-// STEP 7: The Main Routine
-func main() {
-	// Initialize a sync.WaitGroup variable.
-
-	// Create a derived context using context.WithTimeout based on context.Background().
-	// Set the timeout duration to 200 milliseconds.
-	// Defer the cancellation function to avoid leaks.
-
-	// STEP 8: Dispatch Goroutines
-	// Increment the WaitGroup counter by 3.
-
-	// Launch 3 separate goroutines calling processData.
-	// 1. Pass the string "Alpha".
-	// 2. Pass the integer 42.
-	// 3. Pass a boolean true.
-
-	// STEP 9: Wait for Completion
-	// Block execution until all goroutines have finished using the WaitGroup.
-	// Print "Program exit".
-}
\ No newline at end of file
+package main
+
+// STEP 1: Setup and Imports
+// Import context, fmt and sync for the walkthrough below, errors for the
+// sentinel errors, reflect to report unknown types and runtime/debug for
+// the stack of a recovered panic. Timing goes through the Clock in
+// clock.go; time is only used for durations.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrContextCancelled is matched by the *CancelledError processData returns
+// when the context is done before the simulated work completes.
+var ErrContextCancelled = errors.New("context cancelled")
+
+// ErrUnsupportedType is matched by the *UnsupportedTypeError processData
+// returns when the payload does not match any case of the type switch.
+var ErrUnsupportedType = errors.New("unsupported type")
+
+// ErrProcessingPanic is matched by the *PanicError processData returns when
+// processing a payload panics.
+var ErrProcessingPanic = errors.New("panic while processing data")
+
+// ErrPayloadTooLarge is matched by the *PayloadTooLargeError processData
+// returns when a payload is longer than WithMaxPayloadBytes allows.
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+// ErrInsufficientBudget is the error of an item skipped under WithBudgetCheck
+// because its context's deadline would pass before the work could finish.
+var ErrInsufficientBudget = errors.New("insufficient time budget")
+
+// STEP 2: Define the Worker Function
+// Define a function named processData.
+// Arguments:
+// 1. ctx of type context.Context
+// 2. wg as a pointer to sync.WaitGroup
+// 3. data as an empty interface (interface{})
+// 4. results as a send-only channel receiving the item's Result (may be nil)
+// 5. opts tuning the processing, e.g. WithWorkDuration or WithLogger
+// It returns nil on success, a *CancelledError on timeout, an
+// *UnsupportedTypeError for payloads the type switch does not handle, a
+// *PayloadTooLargeError for payloads over WithMaxPayloadBytes, a
+// *PanicError if processing panicked and the *OptionError values, joined,
+// under invalid options. Each matches the corresponding sentinel error under
+// errors.Is.
+//
+// A nil wg is not signalled and a nil ctx is treated as
+// context.Background(), so a partially wired caller degrades gracefully
+// instead of panicking.
+func processData(ctx context.Context, wg *sync.WaitGroup, data interface{}, results chan<- Result, opts ...Option) error {
+
+	// STEP 3: Implement WaitGroup Signal
+	// Strictly as the first line: defer the call to signal the wait group (wg.Done()).
+	defer signalDone(wg)
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	o := newOptions(opts)
+	res := o.handle(ctx, data, o.middleware)
+	o.account(data, res)
+	o.deliver(ctx, results, res)
+	if o.finish != nil {
+		o.finish()
+	}
+	return res.Err
+}
+
+// signalDone signals wg, if there is one.
+func signalDone(wg *sync.WaitGroup) {
+	if wg != nil {
+		wg.Done()
+	}
+}
+
+// Classify runs Steps 4 to 6 for a single payload on the calling goroutine
+// and returns its Result. It is the core of processData without the
+// WaitGroup and results channel, convenient for benchmarks and for callers
+// that want a synchronous answer. A nil ctx is treated as
+// context.Background().
+func Classify(ctx context.Context, data interface{}, opts ...Option) Result {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return classify(ctx, data, newOptions(opts))
+}
+
+// classify is Classify with the options already resolved: it runs data
+// through the type switch alone and accounts for its Result.
+func classify(ctx context.Context, data interface{}, o *options) Result {
+	res := o.handle(ctx, data, nil)
+	o.account(data, res)
+	return res
+}
+
+// handle runs data through mws, composed with Chain, around the type switch
+// and returns the Result coming out of the chain.
+func (o *options) handle(ctx context.Context, data interface{}, mws []Middleware) (res Result) {
+	ctx = o.withValues(ctx)
+	if o.secondary != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = MergeContexts(ctx, o.secondary)
+		defer cancel()
+	}
+	if po, ok := ProcessOptionsFromContext(ctx); ok {
+		o = o.override(po)
+	}
+
+	// Trace the item, processing it under the span's context. The deferred
+	// closure reads res once the recovery below has filled it in.
+	ctx, endSpan := o.startSpan(ctx, data)
+	defer func() { endSpan(res.Err) }()
+
+	start := o.clk().Now()
+	log := o.log()
+	o.record(ctx, "started")
+	id, _ := ItemIDFromContext(ctx)
+	correlationID, hasCorrelationID := CorrelationIDFromContext(ctx)
+	if hasCorrelationID {
+		log = prefixLogger{id: correlationID, next: log}
+	}
+
+	// Derive the per-item deadline from ctx, so cancelling the parent still
+	// cancels the item.
+	if d := o.itemDeadline(); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withTimeout(ctx, d, o.clk())
+		defer cancel()
+	}
+
+	// Recover from a panic in any middleware or branch of the type switch
+	// and turn it into a Result, so one bad item cannot take down the
+	// program or leave a caller's WaitGroup unsignalled. A panic once ctx is
+	// already done is most likely fallout from the cancellation, so the item
+	// is reported as cancelled, keeping the panic in Result.Panic. Whatever
+	// Result comes out, even one a middleware made up, is then labelled
+	// with the item's ID and timings.
+	state := Queued
+	defer func() {
+		if r := recover(); r != nil {
+			res = Result{Input: data, Stack: debug.Stack()}
+			perr := &PanicError{Value: r, Stack: res.Stack}
+			o.panics.catch(perr)
+			if ctx.Err() != nil {
+				res.markCancelled(ctx, start, o.clk().Now())
+				res.Panic = perr
+				log.Logf("%s (%v)", res.Output, perr)
+			} else {
+				res.Kind = KindPanic
+				res.Output = fmt.Sprintf("recovered from panic processing data: %v", r)
+				res.Err = perr
+				log.Logf("%s", res.Output)
+			}
+		}
+		res.ID = id
+		if hasCorrelationID {
+			res.CorrelationID = correlationID
+		}
+		o.stamp(&res, start)
+		res.FinishedAt = o.clk().Now()
+		elapsed := res.FinishedAt.Sub(start)
+		res.ProcessTime = elapsed
+		if o.verbose {
+			log.Logf("Detail: %T input %v -> kind %s, err %v, after %v", data, data, res.Kind, res.Err, elapsed)
+		}
+		o.transition(ctx, state, finalState(res))
+		o.record(ctx, "classified:"+res.Kind.String())
+		if res.Kind == KindCancelled {
+			o.record(ctx, "cancelled")
+		} else {
+			o.record(ctx, "completed")
+		}
+	}()
+
+	// Reject the item outright under invalid options rather than process
+	// it with their settings quietly left at the defaults.
+	if err := o.validate(); err != nil {
+		res = Result{Input: data, Kind: KindRejected, Err: err}
+		res.Output = fmt.Sprintf("Rejected data: %v, invalid options", data)
+		log.Logf("%s", res.Output)
+		return res
+	}
+
+	core := func(ctx context.Context, data interface{}) Result {
+		return o.process(ctx, data, start, log, &state)
+	}
+	return Chain(mws...)(core)(ctx, data)
+}
+
+// account counts res, the Result of data, in the Stats, type counts,
+// latency histogram and adaptive timeout, and hands it to the sink and the
+// WorkerPool's Results.
+func (o *options) account(data interface{}, res Result) {
+	o.stats.record(res, res.ProcessTime)
+	o.types.record(data)
+	o.histogram.record(res, res.ProcessTime)
+	o.adaptive.observe(res, res.ProcessTime)
+	o.emit(res)
+	if o.collect != nil {
+		o.collect(res)
+	}
+}
+
+// process runs the type switch on data, started at start, logging to log
+// and moving *state along as the item starts running.
+func (o *options) process(ctx context.Context, data interface{}, start time.Time, log Logger, state *State) Result {
+	res := Result{Input: data}
+
+	// Fail fast if the context expired before this worker got to run, so
+	// the outcome does not depend on which select case wins below.
+	if ctx.Err() != nil {
+		res.markCancelled(ctx, start, o.clk().Now())
+		log.Logf("%s", res.Output)
+		return res
+	}
+
+	// Wait for a slot under WithMaxInFlight, holding it until the item is
+	// done, whichever worker runs it.
+	if !o.acquire(ctx) {
+		res.markCancelled(ctx, start, o.clk().Now())
+		log.Logf("%s", res.Output)
+		return res
+	}
+	defer o.release()
+	*state = Running
+	o.transition(ctx, Queued, Running)
+
+	// Warn, without interrupting the item, if it is still running after the
+	// WithSlowWarning threshold.
+	defer o.watchSlow(log, data)()
+
+	// Under WithBudgetCheck, skip work that cannot finish before the deadline
+	// instead of tying up the worker until it is cancelled.
+	if left, ok := o.budgetShort(ctx); ok {
+		res.Kind = KindSkipped
+		res.Output = fmt.Sprintf("Skipped data: %v, %v left of the %v needed", data, left.Round(time.Millisecond), o.work())
+		res.Err = ErrInsufficientBudget
+		log.Logf("%s", res.Output)
+		return res
+	}
+
+	// Under WithMaxPayloadBytes, reject oversized payloads outright.
+	if err := o.oversized(data); err != nil {
+		res.Kind = KindRejected
+		res.Length = err.Size
+		res.Output = fmt.Sprintf("Rejected data: %T of %d bytes exceeds the %d byte limit", data, err.Size, err.Max)
+		res.Err = err
+		log.Logf("%s", res.Output)
+		return res
+	}
+
+	// STEP 4: Implement Type Assertion (The "Check")
+	// Use the "comma-ok" idiom to check if 'data' is a string.
+	// If it is a string, print: "Checking string length...".
+	// Do not perform other logic here.
+	if _, ok := data.(string); ok {
+		log.Logf("Checking string length...")
+	}
+
+	// STEP 5: Implement the Context/Timeout Logic
+	// Simulate work by sleeping for workDuration (500ms by default) through
+	// the Clock, or not at all under WithNoDelay, with an interruptible sleep.
+	// If ctx is done first, print "Context timed out for data: " (or "Context
+	//    cancelled for data: " after an explicit cancel) followed by the data
+	//    value and elapsed time, and record a "cancelled" Result.
+	// Otherwise go on with the logic for Step 6, also when the work and ctx
+	//    finish at the same moment. The fast-fail check above has already
+	//    turned an expired context into a cancelled Result.
+	if err := o.sleep(ctx, o.work()); err != nil {
+		res.markCancelled(ctx, start, o.clk().Now())
+	} else {
+
+		// STEP 6: Implement Type Switch (The "Processing")
+		// Create a type switch on 'data'.
+		// Case string: Print "Processed String: " followed by the string value and its length.
+		// Case int: Print "Processed Int: " followed by the integer value.
+		// Case bool: Print "Processed Bool: " followed by the boolean value.
+		// Case float64: Print "Processed Float: " followed by the value to two decimals.
+		// Case []byte: Print "Processed Bytes: " followed by the byte and rune counts.
+		// Case nil: Print "Received nil payload".
+		// Case Fetcher: Print "Processed Fetch: " followed by the fetched value,
+		//    retrying transient failures as configured by WithRetry.
+		// Default: Use the handler registered for the dynamic type, if any, or
+		//    decode the payload once with WithFallbackDecoder.
+		//    Otherwise print "Unknown type encountered: " followed by the dynamic type
+		//    and its reflect kind, or panic with a *StrictTypeError under WithStrictTypes.
+		// A decoded payload of one of the common types above is handled
+		// through fastPaths; any other goes through the switch once more.
+		// decoded stops a decoder returning yet another unknown type from
+		// looping.
+		payload, decoded := data, false
+		for {
+			switch v := payload.(type) {
+			case string:
+				processString(o, v, &res)
+			case int:
+				processInt(o, v, &res)
+			case bool:
+				processBool(o, v, &res)
+			case float64:
+				processFloat(o, v, &res)
+			case []byte:
+				processBytes(o, v, &res)
+			case nil:
+				res.Kind = KindNil
+				res.Output = "Received nil payload"
+			case Fetcher:
+				out, attempts, err := o.retry(ctx, v.Fetch)
+				res.Attempts = attempts
+				switch {
+				case errors.Is(err, ErrContextCancelled):
+					res.markCancelled(ctx, start, o.clk().Now())
+				case err != nil:
+					res.Kind = KindFailed
+					res.Output = fmt.Sprintf("Fetch failed after %d attempts: %v", attempts, err)
+					res.Err = err
+				default:
+					res.Kind = KindFetched
+					res.Output = fmt.Sprintf("Processed Fetch: %s", out)
+				}
+			default:
+				if handle, ok := o.registry.lookup(v); ok {
+					res.Kind = KindCustom
+					res.Output = handle(v)
+					break
+				}
+				if !decoded && o.fallback != nil {
+					if nv, ok := o.fallback(v); ok {
+						if process, ok := fastPaths[reflect.TypeOf(nv)]; ok {
+							process(o, nv, &res)
+							break
+						}
+						payload, decoded = nv, true
+						continue
+					}
+				}
+				// v cannot be a nil interface here, the nil case above takes
+				// it, so reflect.TypeOf never returns nil.
+				t := reflect.TypeOf(v)
+				if o.strictTypes {
+					panic(&StrictTypeError{Type: t})
+				}
+				res.Kind = KindUnknown
+				res.ReflectKind = t.Kind()
+				res.Output = fmt.Sprintf("Unknown type encountered: %v (kind: %v)", t, t.Kind())
+				res.Err = &UnsupportedTypeError{Type: t}
+			}
+			break
+		}
+	}
+
+	log.Logf("%s", res.Output)
+	return res
+}
+
+// STEP 7: The Main Routine
+func main() {
+	if _, err := Run(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// Run dispatches the configured items (by default "Alpha", 42 and true) to
+// processData under a shared timeout (200ms by default), waits for all of
+// them, prints a summary and returns the collected Results. If any Option
+// is invalid it dispatches nothing and returns their errors, as Validate
+// does.
+func Run(opts ...Option) ([]Result, error) {
+	o := newOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	log := o.log()
+	items := o.runItems()
+
+	// Create a derived context using context.WithTimeout (via the Clock) based on context.Background().
+	// Set the timeout duration (200 milliseconds by default).
+	// Defer the cancellation function to avoid leaks.
+	ctx, cancel := withTimeout(context.Background(), o.runTimeout(), o.clk())
+	defer cancel()
+
+	// STEP 8: Dispatch Goroutines
+	// Launch one goroutine calling processData per item, or call it in turn
+	// under WithSynchronous; dispatch increments the WaitGroup counter for
+	// each item right before launching it.
+	// The results channel has room for every Result unless WithResultBuffer
+	// says otherwise; it is drained concurrently, so workers only stall on
+	// it while the consumer is behind.
+	// WithSummary reads the Stats of the batch, so make sure it has some.
+	if o.summary && o.stats == nil {
+		o.stats = new(Stats)
+		opts = append(opts[:len(opts):len(opts)], WithStats(o.stats))
+	}
+	before := o.stats.counts()
+	begun := o.clk().Now()
+
+	results := make(chan Result, o.resultBuffer(len(items)))
+	var collected []Result
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for r := range results {
+			collected = append(collected, r)
+		}
+	}()
+	wg := dispatch(ctx, items, results, opts)
+
+	// STEP 9: Wait for Completion
+	// Block execution until all goroutines have finished using the WaitGroup.
+	// Close the results channel, wait for the drain and print a summary.
+	// Print "Program exit".
+	wg.Wait()
+	elapsed := o.clk().Now().Sub(begun)
+	close(results)
+	<-drained
+	o.repanic()
+	printSummary(log, collected)
+	if o.summary {
+		o.stats.counts().since(before).log(log, elapsed)
+	}
+
+	log.Logf("Program exit")
+	return collected, nil
+}
+
+// printSummary logs how many Results of each kind were collected.
+func printSummary(log Logger, results []Result) {
+	counts := Counts(results)
+	log.Logf("Summary: %d results (string=%d int=%d bool=%d unknown=%d cancelled=%d)",
+		len(results), counts[KindString], counts[KindInt], counts[KindBool], counts[KindUnknown], counts[KindCancelled])
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessDataCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	err := processData(ctx, &wg, 42, nil, WithLogger(nopLogger{}))
+	wg.Wait()
+	if !errors.Is(err, ErrContextCancelled) {
+		t.Fatalf("err = %v, want ErrContextCancelled", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want it to match context.Canceled", err)
+	}
+}
+
+func TestProcessDataTimedOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	err := processData(ctx, nil, "Alpha", nil, WithWorkDuration(time.Hour), WithLogger(nopLogger{}))
+	if !errors.Is(err, ErrContextCancelled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want ErrContextCancelled from the deadline", err)
+	}
+}
+
+func TestProcessDataUnsupportedType(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	err := processData(context.Background(), &wg, struct{}{}, nil, WithNoDelay(), WithLogger(nopLogger{}))
+	wg.Wait()
+
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("err = %v, want ErrUnsupportedType", err)
+	}
+	var uerr *UnsupportedTypeError
+	if !errors.As(err, &uerr) || uerr.Type.String() != "struct {}" {
+		t.Fatalf("err = %v, want an *UnsupportedTypeError naming struct {}", err)
+	}
+	if !strings.Contains(err.Error(), "struct {}") {
+		t.Fatalf("err = %q, want the dynamic type in the message", err)
+	}
+}
+
+func TestProcessDataSuccess(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	if err := processData(context.Background(), &wg, 42, nil, WithNoDelay(), WithLogger(nopLogger{})); err != nil {
+		t.Fatalf("processData = %v, want nil", err)
+	}
+	wg.Wait()
+}
+
+func TestProcessDataResultKinds(t *testing.T) {
+	tests := []struct {
+		data interface{}
+		kind Kind
+	}{
+		{"Alpha", KindString},
+		{42, KindInt},
+		{true, KindBool},
+	}
+	for _, tt := range tests {
+		results := make(chan Result, 1)
+		processData(context.Background(), nil, tt.data, results, WithNoDelay(), WithLogger(nopLogger{}))
+		r := <-results
+		if r.Kind != tt.kind || r.Input != tt.data {
+			t.Errorf("processData(%v) sent %+v, want Kind %s", tt.data, r, tt.kind)
+		}
+	}
+}
+
+func TestProcessDataSendRespectsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan Result) // never read
+
+	errc := make(chan error, 1)
+	go func() { errc <- processData(ctx, nil, 42, results, WithNoDelay(), WithLogger(nopLogger{})) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-errc:
+	case <-time.After(time.Second):
+		t.Fatal("processData blocked on an unread results channel after cancel")
+	}
+}
+
+// panicFetcher is a payload whose processing panics.
+type panicFetcher struct{ value interface{} }
+
+func (f panicFetcher) Fetch(context.Context) (string, error) { panic(f.value) }
+
+func TestProcessDataRecoversPanic(t *testing.T) {
+	log := new(captureLogger)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	results := make(chan Result, 1)
+	err := processData(context.Background(), &wg, panicFetcher{"boom"}, results, WithNoDelay(), WithLogger(log))
+	wg.Wait()
+
+	if !errors.Is(err, ErrProcessingPanic) {
+		t.Fatalf("err = %v, want ErrProcessingPanic", err)
+	}
+	if r := <-results; r.Kind != KindPanic || r.Err != err {
+		t.Fatalf("Result = %+v, want Kind panic carrying the error", r)
+	}
+	if !log.contains("recovered from panic processing data: boom") {
+		t.Fatalf("log = %q, want the recovered value", log.Lines())
+	}
+}
+
+func TestClassifyExtraTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+		kind Kind
+		out  string
+	}{
+		{"float", 3.14159, KindFloat, "Processed Float: 3.14"},
+		{"bytes", []byte("abc"), KindBytes, "Processed Bytes: 3 bytes (3 runes)"},
+		{"nil", nil, KindNil, "Received nil payload"},
+		{"map", map[string]int{"a": 1}, KindUnknown, "Unknown type encountered: map[string]int (kind: map)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Classify(context.Background(), tt.data, WithNoDelay(), WithLogger(nopLogger{}))
+			if r.Kind != tt.kind || r.Output != tt.out {
+				t.Fatalf("Classify = (%s, %q), want (%s, %q)", r.Kind, r.Output, tt.kind, tt.out)
+			}
+			if (tt.kind == KindUnknown) != errors.Is(r.Err, ErrUnsupportedType) {
+				t.Fatalf("Err = %v", r.Err)
+			}
+		})
+	}
+}
+
+func TestRunProcessesBeforeTimeout(t *testing.T) {
+	log := new(captureLogger)
+	results, err := Run(
+		WithTimeout(time.Second),
+		WithWorkDuration(10*time.Millisecond),
+		WithItems("Alpha", 42),
+		WithLogger(log),
+	)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	counts := Counts(results)
+	if counts[KindString] != 1 || counts[KindInt] != 1 {
+		t.Fatalf("counts = %v, want one string and one int", counts)
+	}
+	if lines := log.Lines(); lines[len(lines)-1] != "Program exit" {
+		t.Fatalf("last line = %q, want Program exit", lines[len(lines)-1])
+	}
+}
+
+func TestRunDefaults(t *testing.T) {
+	results, err := Run(WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// The default 500ms of work cannot finish within the default 200ms.
+	inputs := make(map[interface{}]bool)
+	for _, r := range results {
+		inputs[r.Input] = true
+		if r.Kind != KindCancelled {
+			t.Errorf("%v: Kind %s, want cancelled", r.Input, r.Kind)
+		}
+	}
+	for _, in := range defaultItems {
+		if !inputs[in] {
+			t.Errorf("default item %v not dispatched", in)
+		}
+	}
+}
+
+func TestClassifyStringLength(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  interface{}
+		runes bool
+		len   int
+		out   string
+	}{
+		{"ascii", "Alpha", false, 5, "Processed String: Alpha (length 5)"},
+		{"emoji bytes", "hi 👋", false, 7, "Processed String: hi 👋 (length 7)"},
+		{"emoji runes", "hi 👋", true, 4, "Processed String: hi 👋 (length 4)"},
+		{"int", 42, false, 0, "Processed Int: 42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithNoDelay(), WithLogger(nopLogger{})}
+			if tt.runes {
+				opts = append(opts, WithCountRunes())
+			}
+			r := Classify(context.Background(), tt.data, opts...)
+			if r.Length != tt.len || r.Output != tt.out {
+				t.Fatalf("Classify = (%d, %q), want (%d, %q)", r.Length, r.Output, tt.len, tt.out)
+			}
+		})
+	}
+}
+
+func TestRunDispatchesEveryItem(t *testing.T) {
+	sink := new(recordingSink)
+	results, err := Run(WithItems("a", 1, true, 2.5, nil), WithNoDelay(), WithTimeout(time.Second),
+		WithSink(sink), WithLogger(nopLogger{}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	// Run only returns after Wait, so all five must have signalled Done.
+	if len(results) != 5 || len(sink.Results()) != 5 {
+		t.Fatalf("Run returned %d Results with %d emitted, want 5", len(results), len(sink.Results()))
+	}
+	for _, r := range results {
+		if r.Kind == KindCancelled {
+			t.Errorf("%v was cancelled", r.Input)
+		}
+	}
+}
+
+func TestClassifyCancelledOnEntry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r := Classify(ctx, 42, WithNoDelay(), WithLogger(nopLogger{})); r.Kind != KindCancelled {
+		t.Fatalf("Kind = %s, want cancelled", r.Kind)
+	}
+}
+
+func BenchmarkClassify(b *testing.B) {
+	ctx := context.Background()
+	opts := []Option{WithNoDelay(), WithLogger(nopLogger{})}
+	b.ReportAllocs()
+	for b.Loop() {
+		Classify(ctx, "Alpha", opts...)
+	}
+}
+
+func BenchmarkProcessData(b *testing.B) {
+	ctx := context.Background()
+	opts := []Option{WithNoDelay(), WithLogger(nopLogger{})}
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	for b.Loop() {
+		wg.Add(1)
+		processData(ctx, &wg, "Alpha", nil, opts...)
+	}
+}
+
+func TestProcessDataExpiredOnEntry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	for _, data := range []interface{}{"Alpha", 42, true, 2.5} {
+		log := new(captureLogger)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		// No work delay, so without the entry check the work would win.
+		processData(ctx, &wg, data, nil, WithNoDelay(), WithLogger(log))
+		wg.Wait()
+		if log.contains("Processed") || log.contains("Checking") {
+			t.Errorf("%v: logged %q on an expired context", data, log.Lines())
+		}
+	}
+}
+
+func TestClassifyBytesRunes(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          []byte
+		length, runes int
+		out           string
+	}{
+		{"ascii", []byte("hello"), 5, 5, "Processed Bytes: 5 bytes (5 runes)"},
+		{"utf-8", []byte("héllo 世界"), 13, 8, "Processed Bytes: 13 bytes (8 runes)"},
+		{"invalid", []byte{'a', 0xff, 0xfe}, 3, 3, "Processed Bytes: 3 bytes (3 runes, invalid utf-8)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Classify(context.Background(), tt.data, WithNoDelay(), WithLogger(nopLogger{}))
+			if r.Length != tt.length || r.RuneLength != tt.runes || r.Output != tt.out {
+				t.Fatalf("Classify = (%d, %d, %q), want (%d, %d, %q)", r.Length, r.RuneLength, r.Output, tt.length, tt.runes, tt.out)
+			}
+		})
+	}
+}
+
+func TestProcessDataPanicStack(t *testing.T) {
+	log := new(captureLogger)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	results := make(chan Result, 1)
+	processData(context.Background(), &wg, panicFetcher{"boom"}, results, WithNoDelay(), WithLogger(log))
+	// A second Done would have panicked with a negative counter.
+	wg.Wait()
+
+	r := <-results
+	if len(r.Stack) == 0 || !strings.Contains(string(r.Stack), "processData") {
+		t.Fatalf("Stack = %q, want the panicking goroutine's stack through processData", r.Stack)
+	}
+	var perr *PanicError
+	if !errors.As(r.Err, &perr) || string(perr.Stack) != string(r.Stack) {
+		t.Fatal("the PanicError does not carry the Result's stack")
+	}
+	for _, line := range log.Lines() {
+		if strings.Contains(line, "\n") {
+			t.Errorf("logged a multi-line message %q", line)
+		}
+	}
+}
+
+func TestClassifyNoStackWithoutPanic(t *testing.T) {
+	if r := Classify(context.Background(), 42, WithNoDelay(), WithLogger(nopLogger{})); r.Stack != nil {
+		t.Fatal("Stack captured without a panic")
+	}
+}
+
+func TestCancelledResultMetadata(t *testing.T) {
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+		r := Classify(ctx, 42, WithWorkDuration(time.Hour), WithLogger(nopLogger{}))
+		if r.CancelCause != context.DeadlineExceeded {
+			t.Fatalf("CancelCause = %v, want context.DeadlineExceeded", r.CancelCause)
+		}
+		if r.DeadlineExceededBy < 0 || r.DeadlineExceededBy > time.Second {
+			t.Fatalf("DeadlineExceededBy = %v, want a small non-negative lag", r.DeadlineExceededBy)
+		}
+	})
+	t.Run("manual", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(5*time.Millisecond, cancel)
+		r := Classify(ctx, 42, WithWorkDuration(time.Hour), WithLogger(nopLogger{}))
+		if r.CancelCause != context.Canceled || r.DeadlineExceededBy != 0 {
+			t.Fatalf("CancelCause = %v, DeadlineExceededBy = %v, want context.Canceled and zero", r.CancelCause, r.DeadlineExceededBy)
+		}
+	})
+}
+
+func TestClassifyBool(t *testing.T) {
+	for _, b := range []bool{true, false} {
+		r := Classify(context.Background(), b, WithNoDelay(), WithLogger(nopLogger{}))
+		if r.Kind != KindBool || r.Err != nil || r.Output != fmt.Sprintf("Processed Bool: %t", b) {
+			t.Errorf("Classify(%t) = (%s, %q, %v)", b, r.Kind, r.Output, r.Err)
+		}
+	}
+}
+
+func TestProcessDataNilArguments(t *testing.T) {
+	results := make(chan Result, 2)
+	if err := processData(context.Background(), nil, 42, results, WithNoDelay(), WithLogger(nopLogger{})); err != nil {
+		t.Fatalf("nil wg: %v", err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	if err := processData(nil, &wg, 42, results, WithNoDelay(), WithLogger(nopLogger{})); err != nil {
+		t.Fatalf("nil ctx: %v", err)
+	}
+	wg.Wait()
+	for i := 0; i < 2; i++ {
+		if r := <-results; r.Kind != KindInt {
+			t.Errorf("Kind = %s, want int", r.Kind)
+		}
+	}
+	if r := Classify(nil, "a", WithNoDelay(), WithLogger(nopLogger{})); r.Kind != KindString {
+		t.Errorf("Classify(nil ctx) Kind = %s, want string", r.Kind)
+	}
+}
+
+func TestClassifyReflectKind(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+		kind reflect.Kind
+		out  string
+	}{
+		{"pointer", &Order{ID: 7}, reflect.Ptr, "Unknown type encountered: *main.Order (kind: ptr)"},
+		{"map", map[string]int{"a": 1}, reflect.Map, "Unknown type encountered: map[string]int (kind: map)"},
+		{"chan", make(chan int), reflect.Chan, "Unknown type encountered: chan int (kind: chan)"},
+		{"nil", nil, reflect.Invalid, "Received nil payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Classify(context.Background(), tt.data, WithNoDelay(), WithLogger(nopLogger{}))
+			if r.ReflectKind != tt.kind || r.Output != tt.out {
+				t.Fatalf("Classify = (%v, %q), want (%v, %q)", r.ReflectKind, r.Output, tt.kind, tt.out)
+			}
+		})
+	}
+}
+
+func TestWithStrictTypes(t *testing.T) {
+	quiet := []Option{WithNoDelay(), WithLogger(nopLogger{})}
+	for _, strict := range []bool{false, true} {
+		opts := quiet
+		if strict {
+			opts = append(opts[:len(opts):len(opts)], WithStrictTypes())
+		}
+
+		// A supported payload is processed the same either way.
+		if r := Classify(context.Background(), true, opts...); r.Kind != KindBool || r.Err != nil {
+			t.Errorf("strict=%t: bool = (%s, %v), want processed", strict, r.Kind, r.Err)
+		}
+
+		r := Classify(context.Background(), Order{}, opts...)
+		var serr *StrictTypeError
+		switch {
+		case !strict && (r.Kind != KindUnknown || errors.As(r.Err, &serr)):
+			t.Errorf("lenient: Order = (%s, %v), want unknown", r.Kind, r.Err)
+		case strict && (r.Kind != KindPanic || !errors.As(r.Err, &serr) || serr.Type != reflect.TypeFor[Order]()):
+			t.Errorf("strict: Order = (%s, %v), want a recovered *StrictTypeError for main.Order", r.Kind, r.Err)
+		case strict && !errors.Is(r.Err, ErrUnsupportedType):
+			t.Errorf("strict: Err = %v, want it to match ErrUnsupportedType", r.Err)
+		}
+	}
+}